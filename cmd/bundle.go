@@ -0,0 +1,180 @@
+// Copyright © 2017 Alexandre Bourget <alex@bourget.cc>
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/abourget/secrets-bridge/pkg/bundle"
+	"github.com/abourget/secrets-bridge/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+// bundleCmd represents the bundle command
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Manage passphrase-encrypted bundles of secrets, to be loaded with 'serve --secrets-bundle'.",
+	Long: `Example:
+
+Create a bundle, which can be committed to your repository:
+
+    secrets-bridge bundle create build-secrets.bundle --secret npm_token=abc --secret-from-file id_rsa=deploy_key
+
+Add, replace or remove secrets:
+
+    secrets-bridge bundle edit build-secrets.bundle --secret npm_token=def --remove id_rsa
+
+List the keys in a bundle:
+
+    secrets-bridge bundle list build-secrets.bundle
+`,
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create FILE",
+	Short: "Create a new encrypted bundle",
+	Run: func(cmd *cobra.Command, args []string) {
+		filename := bundleFilenameArg(args)
+		if _, err := os.Stat(filename); err == nil {
+			log.Fatalf("%q already exists, use 'bundle edit' to modify it\n", filename)
+		}
+
+		store := &secrets.Store{}
+		if err := addBundleSecrets(store); err != nil {
+			log.Fatalln(err)
+		}
+
+		passphrase, err := readPassphrase("Bundle passphrase: ", true)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if err := bundle.WriteFile(filename, store.Secrets, passphrase); err != nil {
+			log.Fatalln("Error writing bundle:", err)
+		}
+
+		fmt.Printf("Wrote %d secrets to %q\n", len(store.Secrets), filename)
+	},
+}
+
+var bundleEditCmd = &cobra.Command{
+	Use:   "edit FILE",
+	Short: "Add, replace or remove secrets in an encrypted bundle",
+	Run: func(cmd *cobra.Command, args []string) {
+		filename := bundleFilenameArg(args)
+
+		passphrase, err := readPassphrase("Bundle passphrase: ", false)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		values, err := bundle.ReadFile(filename, passphrase)
+		if err != nil {
+			log.Fatalf("Error reading bundle %q: %s\n", filename, err)
+		}
+
+		store := &secrets.Store{}
+		store.SetAll(values)
+		if err := addBundleSecrets(store); err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, key := range bundleRemoveKeys {
+			if _, found := store.Secrets[key]; !found {
+				log.Fatalf("Key %q not found in bundle\n", key)
+			}
+			store.Delete(key)
+		}
+
+		if err := bundle.WriteFile(filename, store.Secrets, passphrase); err != nil {
+			log.Fatalln("Error writing bundle:", err)
+		}
+
+		fmt.Printf("Wrote %d secrets to %q\n", len(store.Secrets), filename)
+	},
+}
+
+var bundleListCmd = &cobra.Command{
+	Use:   "list FILE",
+	Short: "List the keys of an encrypted bundle, never their values",
+	Run: func(cmd *cobra.Command, args []string) {
+		filename := bundleFilenameArg(args)
+
+		passphrase, err := readPassphrase("Bundle passphrase: ", false)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		values, err := bundle.ReadFile(filename, passphrase)
+		if err != nil {
+			log.Fatalf("Error reading bundle %q: %s\n", filename, err)
+		}
+
+		var keys []string
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			fmt.Printf("%s\t%d bytes\n", key, len(values[key]))
+		}
+	},
+}
+
+var bundleSecretLiterals []string
+var bundleSecretsFromFiles []string
+var bundleRemoveKeys []string
+
+func init() {
+	RootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleCreateCmd, bundleEditCmd, bundleListCmd)
+
+	for _, c := range []*cobra.Command{bundleCreateCmd, bundleEditCmd} {
+		c.Flags().StringSliceVar(&bundleSecretLiterals, "secret", []string{}, "Literal secret, in the form `key=value`. 'key' can be prefixed by 'b64:' and friends to indicate the encoding of the value")
+		c.Flags().StringSliceVar(&bundleSecretsFromFiles, "secret-from-file", []string{}, "Secret from the content of a file, in the form `key=filename`. 'key' can be prefixed by 'b64:' and friends to indicate the encoding of the file")
+	}
+	bundleEditCmd.Flags().StringSliceVar(&bundleRemoveKeys, "remove", []string{}, "Remove the secret `key` from the bundle")
+
+	for _, c := range []*cobra.Command{bundleCreateCmd, bundleEditCmd, bundleListCmd} {
+		addPassphraseFlags(c.Flags())
+	}
+}
+
+func bundleFilenameArg(args []string) string {
+	if len(args) != 1 {
+		log.Fatalln("specify one, and only one, bundle file")
+	}
+	return args[0]
+}
+
+func addBundleSecrets(store *secrets.Store) error {
+	for _, secret := range bundleSecretLiterals {
+		parts := strings.SplitN(secret, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf(`invalid secret literal, expected format "key=value", got %q`, secret)
+		}
+		if err := store.Add(parts[0], []byte(parts[1])); err != nil {
+			return fmt.Errorf("error reading literal secret %q: %s", parts[0], err)
+		}
+	}
+
+	for _, secret := range bundleSecretsFromFiles {
+		parts := strings.SplitN(secret, "=", 2)
+		filename := parts[len(parts)-1]
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return fmt.Errorf("error reading file %q: %s", filename, err)
+		}
+		if err := store.Add(parts[0], content); err != nil {
+			return fmt.Errorf("error reading value from secrets file %q: %s", filename, err)
+		}
+	}
+
+	return nil
+}
@@ -7,10 +7,15 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/abourget/secrets-bridge/pkg/agentfwd"
+	"github.com/abourget/secrets-bridge/pkg/client"
+	"github.com/abourget/secrets-bridge/pkg/secrets"
 	"github.com/spf13/cobra"
 )
 
@@ -69,6 +74,28 @@ This invocation will use the bridge config at ~/.bridge-conf by default:
 			env = append(env, fmt.Sprintf("%s=%s", varParts[0], secret))
 		}
 
+		// Secret files are removed on the way out, so signals are
+		// handled from here on.
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+		var writtenFiles []string
+		for _, fileSpec := range secretFiles {
+			filename, err := writeSecretFile(c, fileSpec)
+			if err != nil {
+				removeSecretFiles(writtenFiles)
+				log.Fatalln("failed writing secret file:", err)
+			}
+			writtenFiles = append(writtenFiles, filename)
+		}
+
+		select {
+		case sig := <-signals:
+			removeSecretFiles(writtenFiles)
+			log.Fatalf("secrets-bridge: Received %s, not calling subprocess\n", sig)
+		default:
+		}
+
 		program := args[0]
 		var arguments []string
 		if len(args) > 1 {
@@ -81,13 +108,24 @@ This invocation will use the bridge config at ~/.bridge-conf by default:
 		subprocess.Stderr = os.Stderr
 
 		log.Printf("secrets-bridge: Calling subprocess with: %q\n", args)
-		subErr := subprocess.Run()
+		subErr := subprocess.Start()
+		if subErr == nil {
+			// Pass signals on, and clean up once the subprocess exits.
+			go func() {
+				for sig := range signals {
+					subprocess.Process.Signal(sig)
+				}
+			}()
+			subErr = subprocess.Wait()
+		}
 		log.Printf("secrets-bridge: Call returned, exited with: %s\n", subErr)
 
 		if !disableSSHAgentForwarding {
 			os.Remove(agentfwd.UnixSocket)
 		}
 
+		removeSecretFiles(writtenFiles)
+
 		// now reflect the subprocess error...
 		if subErr != nil {
 			os.Exit(199)
@@ -97,6 +135,7 @@ This invocation will use the bridge config at ~/.bridge-conf by default:
 
 var disableSSHAgentForwarding bool
 var envVars []string
+var secretFiles []string
 
 func init() {
 	RootCmd.AddCommand(execCmd)
@@ -104,4 +143,75 @@ func init() {
 	execCmd.Flags().StringVarP(&bridgeConf, "bridge-conf", "c", "", "Base64-encoded Bridge `configuration`.")
 	execCmd.Flags().BoolVarP(&disableSSHAgentForwarding, "no-ssh-agent", "A", false, "Disable SSH-Agent relay. Otherwise sets SSH_AUTH_SOCK in the subprocess call and listens for incoming Agent calls.")
 	execCmd.Flags().StringSliceVarP(&envVars, "env", "e", []string{}, "Inject secret as environment variable. Use the `ENV_VAR=secret-key` syntax.")
+	execCmd.Flags().StringSliceVarP(&secretFiles, "file", "f", []string{}, "Write secret to a new file for the duration of the call, with the mode from its metadata (0600 by default). Use the `secret-key[=path]` syntax, the path defaults to the base name of the secret's suggested filename, in the current directory. Existing files are never overwritten.")
+}
+
+// writeSecretFile handles `--file key[=path]`, and returns the path. The
+// file must not exist already, as it is removed after the call.
+func writeSecretFile(c *client.Client, spec string) (string, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	key := parts[0]
+
+	md, err := c.GetSecretMeta(key)
+	if err != nil {
+		return "", fmt.Errorf("fetching metadata for %q: %s", key, err)
+	}
+
+	var filename string
+	if len(parts) == 2 {
+		filename = parts[1]
+	} else {
+		// Suggested by the server, so kept to the current directory.
+		suggested := md.Filename
+		if suggested == "" {
+			suggested = key
+		}
+		filename = filepath.Base(filepath.FromSlash(suggested))
+		if filename == "." || filename == ".." || filename == string(filepath.Separator) {
+			return "", fmt.Errorf("invalid filename %q for secret %q, use the `secret-key=path` syntax", suggested, key)
+		}
+	}
+
+	mode, err := md.FileMode()
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := c.GetSecret(key)
+	if err != nil {
+		return "", fmt.Errorf("fetching secret %q: %s", key, err)
+	}
+	defer secrets.Wipe(secret)
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if os.IsExist(err) {
+		return "", fmt.Errorf("%q already exists, refusing to overwrite it", filename)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	_, err = f.Write(secret)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// OpenFile's mode is subject to umask.
+		err = os.Chmod(filename, mode)
+	}
+	if err != nil {
+		os.Remove(filename)
+		return "", err
+	}
+
+	log.Printf("secrets-bridge: Wrote secret %q to %q (mode %04o)\n", key, filename, mode)
+	return filename, nil
+}
+
+func removeSecretFiles(filenames []string) {
+	for _, filename := range filenames {
+		if err := os.Remove(filename); err != nil {
+			log.Printf("secrets-bridge: Couldn't remove secret file: %s\n", err)
+		}
+	}
 }
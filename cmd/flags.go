@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stringArray is a repeatable string flag which, unlike
+// `StringSliceVar`, doesn't split values on commas. Use it for values
+// like shell commands.
+type stringArray []string
+
+func (a *stringArray) Set(value string) error {
+	*a = append(*a, value)
+	return nil
+}
+
+func (a *stringArray) String() string {
+	return fmt.Sprintf("[%s]", strings.Join(*a, " "))
+}
+
+func (a *stringArray) Type() string {
+	return "stringArray"
+}
@@ -0,0 +1,68 @@
+// Copyright © 2017 Alexandre Bourget <alex@bourget.cc>
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/abourget/secrets-bridge/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var issueName string
+var issueScopes []string
+var issueTTL string
+var issueOutput string
+
+// issueCmd represents the issue command
+var issueCmd = &cobra.Command{
+	Use:   "issue",
+	Short: "Issue a new client bridge conf from a running bridge, served with --admin-api.",
+	Long: `The new bridge conf holds its own client cert, limited to the keys matching --scope if any. Hand narrower bridge confs to different Dockerfiles and stages.
+
+Uses the admin bridge conf, which defaults to ~/.bridge-admin-conf.
+
+Example:
+
+secrets-bridge issue --name ci-frontend --scope 'npm/*' --ttl 10m -o frontend.bridge-conf
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if issueName == "" {
+			log.Fatalln("specify the client --name")
+		}
+
+		c, err := newAdminClient(bridgeConf)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		confText, err := c.IssueClient(client.IssueRequest{
+			Name:   issueName,
+			Scopes: issueScopes,
+			TTL:    issueTTL,
+		})
+		if err != nil {
+			log.Fatalln("failed issuing client:", err)
+		}
+
+		if issueOutput == "" {
+			fmt.Println(confText)
+			return
+		}
+		if err := ioutil.WriteFile(issueOutput, []byte(confText), 0600); err != nil {
+			log.Fatalf("Error writing %q: %s\n", issueOutput, err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(issueCmd)
+
+	issueCmd.Flags().StringVarP(&bridgeConf, "bridge-conf", "c", "", "Base64-encoded admin Bridge `configuration`.")
+	issueCmd.Flags().StringVar(&issueName, "name", "", "`NAME` of the client, the identity --policy rules refer to")
+	issueCmd.Flags().StringSliceVar(&issueScopes, "scope", []string{}, "Limit the client to keys matching `PATTERN`, like 'npm/*', or '@ssh-agent' and '@quit' for those features. Can be repeated")
+	issueCmd.Flags().StringVar(&issueTTL, "ttl", "", "How long the client cert is valid, as a `duration`. Defaults to the remaining lifetime of the server's CA, set by --cert-lifetime")
+	issueCmd.Flags().StringVarP(&issueOutput, "output", "o", "", "Write the bridge conf to `FILE` instead of printing it")
+}
@@ -0,0 +1,58 @@
+// Copyright © 2017 Alexandre Bourget <alex@bourget.cc>
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// lsCmd represents the ls command
+var lsCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List the secret keys available on the bridge, optionally within a namespace.",
+	Long: `Keys containing '/' are organized in namespaces. Values are never listed, only their sizes ('?' when unknown until read).
+
+Example:
+
+secrets-bridge ls
+
+secrets-bridge ls -c [BASE64-bridge-conf] npm/
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) > 1 {
+			log.Fatalln("specify at most one namespace to list")
+		}
+
+		var prefix string
+		if len(args) == 1 {
+			prefix = args[0]
+		}
+
+		c, err := newClient(bridgeConf)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		list, err := c.ListSecrets(prefix)
+		if err != nil {
+			log.Fatalln("failed listing secrets:", err)
+		}
+
+		for _, info := range list {
+			size := "?"
+			if info.Size >= 0 {
+				size = fmt.Sprintf("%d", info.Size)
+			}
+			fmt.Printf("%s\t%s\n", info.Key, size)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(lsCmd)
+
+	lsCmd.Flags().StringVarP(&bridgeConf, "bridge-conf", "c", "", "Base64-encoded Bridge `configuration`.")
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+var passphraseEnv string
+var passphraseFD int
+
+// readPassphrase gets the bundle passphrase from the env var named by
+// `--passphrase-env`, from the file descriptor given by
+// `--passphrase-fd`, or by prompting on the terminal.
+func readPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if passphraseEnv != "" {
+		value := os.Getenv(passphraseEnv)
+		if value == "" {
+			return nil, fmt.Errorf("environment variable %q is empty or not set", passphraseEnv)
+		}
+		return []byte(value), nil
+	}
+
+	if passphraseFD >= 0 {
+		f := os.NewFile(uintptr(passphraseFD), "passphrase-fd")
+		if f == nil {
+			return nil, fmt.Errorf("invalid --passphrase-fd %d", passphraseFD)
+		}
+		defer f.Close()
+		return readLine(f)
+	}
+
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("no terminal to prompt for the passphrase, use --passphrase-env or --passphrase-fd: %s", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprint(tty, prompt)
+	passphrase, err := readNoEcho(tty)
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, err
+	}
+
+	if confirm {
+		fmt.Fprint(tty, "Confirm passphrase: ")
+		confirmation, err := readNoEcho(tty)
+		fmt.Fprintln(tty)
+		if err != nil {
+			return nil, err
+		}
+		if string(confirmation) != string(passphrase) {
+			return nil, fmt.Errorf("passphrases do not match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+func readLine(f *os.File) ([]byte, error) {
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && line == "" {
+		return nil, fmt.Errorf("reading passphrase: %s", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+func addPassphraseFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&passphraseEnv, "passphrase-env", "", "Read the bundle passphrase from the environment variable `ENV_NAME`, instead of prompting")
+	flags.IntVar(&passphraseFD, "passphrase-fd", -1, "Read the bundle passphrase from the first line of file descriptor `N`, instead of prompting")
+}
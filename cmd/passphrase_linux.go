@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// readNoEcho reads a line from the terminal with echo disabled.
+func readNoEcho(tty *os.File) ([]byte, error) {
+	fd := tty.Fd()
+
+	var oldState unix.Termios
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TCGETS, uintptr(unsafe.Pointer(&oldState))); errno != 0 {
+		return nil, errno
+	}
+
+	newState := oldState
+	newState.Lflag &^= unix.ECHO
+	newState.Lflag |= unix.ICANON | unix.ISIG
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, unix.TCSETS, uintptr(unsafe.Pointer(&newState))); errno != 0 {
+		return nil, errno
+	}
+	defer unix.Syscall(unix.SYS_IOCTL, fd, unix.TCSETS, uintptr(unsafe.Pointer(&oldState)))
+
+	return readLine(tty)
+}
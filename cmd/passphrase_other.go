@@ -0,0 +1,13 @@
+// +build !linux
+
+package cmd
+
+import (
+	"log"
+	"os"
+)
+
+func readNoEcho(tty *os.File) ([]byte, error) {
+	log.Println("WARNING: can't disable terminal echo on this platform, the passphrase will be visible")
+	return readLine(tty)
+}
@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/abourget/secrets-bridge/pkg/secrets"
 	"github.com/spf13/cobra"
 )
 
@@ -35,6 +36,7 @@ secrets-bridge print -c [BASE64-bridge-conf] hello-secret
 		}
 
 		_, _ = os.Stdout.Write(secret)
+		secrets.Wipe(secret)
 	},
 }
 
@@ -0,0 +1,66 @@
+// Copyright © 2017 Alexandre Bourget <alex@bourget.cc>
+
+package cmd
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/abourget/secrets-bridge/pkg/secrets"
+	"github.com/spf13/cobra"
+)
+
+var putFromFile string
+
+// putCmd represents the put command
+var putCmd = &cobra.Command{
+	Use:   "put",
+	Short: "Set a secret on a running bridge, served with --admin-api.",
+	Long: `The value is read from stdin, unless given as an argument or with --from-file. Prefer stdin, as arguments show up in the process list.
+
+Uses the admin bridge conf, which defaults to ~/.bridge-admin-conf. Keys can be prefixed by 'b64:' and friends to indicate the encoding of the value.
+
+Example:
+
+echo -n $NEW_TOKEN | secrets-bridge put npm_token
+
+secrets-bridge put --from-file ~/.npmrc npmrc
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 || len(args) > 2 {
+			log.Fatalln("specify a key, and optionally its value")
+		}
+
+		var value []byte
+		var err error
+		switch {
+		case len(args) == 2:
+			value = []byte(args[1])
+		case putFromFile != "":
+			value, err = ioutil.ReadFile(putFromFile)
+		default:
+			value, err = ioutil.ReadAll(os.Stdin)
+		}
+		if err != nil {
+			log.Fatalln("failed reading value:", err)
+		}
+		defer secrets.Wipe(value)
+
+		c, err := newAdminClient(bridgeConf)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if err := c.PutSecret(args[0], value); err != nil {
+			log.Fatalln("failed setting secret:", err)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(putCmd)
+
+	putCmd.Flags().StringVarP(&bridgeConf, "bridge-conf", "c", "", "Base64-encoded admin Bridge `configuration`.")
+	putCmd.Flags().StringVar(&putFromFile, "from-file", "", "Read the value from `FILE`")
+}
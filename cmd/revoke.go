@@ -0,0 +1,80 @@
+// Copyright © 2017 Alexandre Bourget <alex@bourget.cc>
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/abourget/secrets-bridge/pkg/client"
+	"github.com/spf13/cobra"
+)
+
+var revokeSerial string
+var revokeName string
+var revokeList bool
+
+// revokeCmd represents the revoke command
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke client bridge confs on a running bridge, served with --admin-api.",
+	Long: `Revoked client certs are refused from then on, and their SSH-Agent forwarding sessions are closed. With --ca-key-store, revoked serials are kept in a file next to it, suffixed with '.revoked', and stay revoked across restarts with the same CA. Otherwise, revocations last until the bridge exits.
+
+Serials are random, see them with --list. Certs issued before a restart can only be revoked by --serial.
+
+Uses the admin bridge conf, which defaults to ~/.bridge-admin-conf.
+
+Example:
+
+secrets-bridge revoke --list
+secrets-bridge revoke --name ci-frontend
+secrets-bridge revoke --serial 1234567890
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if !revokeList && (revokeSerial == "") == (revokeName == "") {
+			log.Fatalln("specify either --serial or --name, or --list")
+		}
+
+		c, err := newAdminClient(bridgeConf)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		if revokeList {
+			clients, err := c.ListClients()
+			if err != nil {
+				log.Fatalln("failed listing clients:", err)
+			}
+			for _, issued := range clients {
+				status := "valid until " + issued.NotAfter.Format(time.RFC3339)
+				if issued.Revoked {
+					status = "revoked"
+				}
+				fmt.Printf("%s\t%s\t%s\t%s\n", issued.Serial, issued.Name, strings.Join(issued.Scopes, ","), status)
+			}
+			return
+		}
+
+		revoked, err := c.RevokeClient(client.RevokeRequest{
+			Serial: revokeSerial,
+			Name:   revokeName,
+		})
+		if err != nil {
+			log.Fatalln("failed revoking client:", err)
+		}
+		for _, issued := range revoked {
+			fmt.Printf("Revoked client %q, serial %s\n", issued.Name, issued.Serial)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(revokeCmd)
+
+	revokeCmd.Flags().StringVarP(&bridgeConf, "bridge-conf", "c", "", "Base64-encoded admin Bridge `configuration`.")
+	revokeCmd.Flags().StringVar(&revokeSerial, "serial", "", "Revoke the client cert with this `SERIAL`, as logged when it was issued")
+	revokeCmd.Flags().StringVar(&revokeName, "name", "", "Revoke all the client certs issued to `NAME`")
+	revokeCmd.Flags().BoolVar(&revokeList, "list", false, "List the client certs issued by the bridge, with their serials, instead")
+}
@@ -0,0 +1,45 @@
+// Copyright © 2017 Alexandre Bourget <alex@bourget.cc>
+
+package cmd
+
+import (
+	"log"
+
+	"github.com/spf13/cobra"
+)
+
+// rmCmd represents the rm command
+var rmCmd = &cobra.Command{
+	Use:   "rm",
+	Short: "Remove secrets from a running bridge, served with --admin-api.",
+	Long: `Only removes secrets held in memory by the bridge, not those from --secret-from-command or --secret-template.
+
+Uses the admin bridge conf, which defaults to ~/.bridge-admin-conf.
+
+Example:
+
+secrets-bridge rm npm_token
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) == 0 {
+			log.Fatalln("specify at least one key to remove")
+		}
+
+		c, err := newAdminClient(bridgeConf)
+		if err != nil {
+			log.Fatalln(err)
+		}
+
+		for _, key := range args {
+			if err := c.DeleteSecret(key); err != nil {
+				log.Fatalf("failed removing secret %q: %s\n", key, err)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(rmCmd)
+
+	rmCmd.Flags().StringVarP(&bridgeConf, "bridge-conf", "c", "", "Base64-encoded admin Bridge `configuration`.")
+}
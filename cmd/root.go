@@ -58,10 +58,22 @@ func initConfig() {
 }
 
 func newClient(bridgeConf string) (*client.Client, error) {
+	return newClientWithDefault(bridgeConf, bridge.NewFromDefaultConfig)
+}
+
+// newAdminClient is like `newClient`, but defaults to the admin bridge
+// conf written by `serve --admin-api`.
+func newAdminClient(bridgeConf string) (*client.Client, error) {
+	return newClientWithDefault(bridgeConf, func() (*bridge.Bridge, error) {
+		return bridge.NewFromFile(adminConfFilenameWithDefault())
+	})
+}
+
+func newClientWithDefault(bridgeConf string, defaultConf func() (*bridge.Bridge, error)) (*client.Client, error) {
 	var brConf *bridge.Bridge
 
 	if bridgeConf == "" {
-		br, err := bridge.NewFromDefaultConfig()
+		br, err := defaultConf()
 		if err != nil {
 			return nil, fmt.Errorf("couldn't load bridge conf: %s", err)
 		}
@@ -1,25 +1,23 @@
 package cmd
 
 import (
-	"bytes"
-	"compress/gzip"
 	"crypto/tls"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/abourget/secrets-bridge/pkg/agentfwd"
+	"github.com/abourget/secrets-bridge/pkg/acl"
 	"github.com/abourget/secrets-bridge/pkg/bridge"
 	"github.com/abourget/secrets-bridge/pkg/secrets"
 	"github.com/spf13/cobra"
-	"golang.org/x/net/websocket"
 )
 
 // serveCmd represents the serve command
@@ -27,15 +25,66 @@ var serveCmd = &cobra.Command{
 	Use:   "serve",
 	Short: "Serves an SSH Agent forwarder over the network, and secrets",
 	Long:  ``,
-	Run:   serveDaemonized,
+	PreRun: func(cmd *cobra.Command, args []string) {
+		// Flags with an optional value, like `--docker-config` and
+		// `--netrc`, take it after `=` only: `--netrc PATH` would leave
+		// PATH here.
+		if len(args) != 0 {
+			log.Fatalf("Unexpected argument %q, serve takes none. Give optional flag values with '=', like --docker-config=PATH or --netrc=PATH\n", args[0])
+		}
+		if err := applyServeConfig(cmd.Flags()); err != nil {
+			log.Fatalln("Error reading serve config:", err)
+		}
+	},
+	Run: serveDaemonized,
 }
 
+var serveConfigFile string
 var caKeyStore string
+var listenAddr string
+var certLifetime time.Duration
 var secretLiterals []string
 var secretsFromFiles []string
+var secretsFromEnv []string
+var secretsFromEnvPrefixes []string
+var secretsDotenvFiles []string
+var secretsDirs []string
+var secretsFromCommands stringArray
+var secretCommandTimeout time.Duration
+var secretCommandRefresh time.Duration
+var secretCommandLazy bool
+var secretsBundles []string
+var dockerConfigFile string
+var dockerRegistries []string
+var netrcFile string
+var gitCredentialsFile string
+var netrcHosts []string
+var sopsFiles []string
+var ageIdentityFiles []string
+var k8sSecretFiles []string
+var k8sNamespace string
+var k8sSelector string
+var vaultAddr string
+var vaultMount string
+var vaultRoleID string
+var vaultSecretIDEnv string
+var awsEnabled bool
+var awsProfile string
+var awsRegion string
+var awsEndpointURL string
+var passEnabled bool
+var passStoreDir string
+var passGPG string
+var secretTemplates []string
+var secretsMeta stringArray
+var secretsMetaFiles []string
 var enableSSHAgent bool
 var timeout int
 var insecureMode bool
+var policyRules stringArray
+var clientSpecs stringArray
+var adminAPI bool
+var adminConfFilename string
 var writeConf bool
 var daemonize string
 
@@ -45,21 +94,69 @@ func init() {
 	serveCmd.Flags().StringVarP(&bridgeConfFilename, "bridge-conf-file", "f", "", "Bridge authentication file. Written to in serve command, read in kill command. Defaults to `~/.bridge-conf`")
 	serveCmd.Flags().BoolVarP(&writeConf, "write-conf", "w", false, "Write the bridge config to a file instead of printing out. Specify file with '--bridge-conf-file'.")
 
+	serveCmd.Flags().StringVar(&serveConfigFile, "config", "", "Read settings and secret declarations from a YAML, TOML or HCL `FILE`, keyed like the flags. Flags given on the command line take precedence. Defaults to .secrets-bridge.* in the current directory or $HOME, if any")
+	serveCmd.Flags().StringVar(&listenAddr, "listen", "", "`HOST:PORT` to listen on. With a HOST, it's the only endpoint in the bridge conf. Defaults to a random port on all interfaces")
+	serveCmd.Flags().DurationVar(&certLifetime, "cert-lifetime", bridge.DefaultCertLifetime, "How long the generated CA and client certs are valid, as a `duration`")
 	serveCmd.Flags().StringVarP(&caKeyStore, "ca-key-store", "", "", "Filenam where to read/store the CA Key if you want to reuse, to avoid changing the bridge conf, thus avoiding Docker rebuilds.")
 	serveCmd.Flags().BoolVarP(&enableSSHAgent, "ssh-agent-forwarder", "A", false, "Enable SSH Agent forwarder. Uses env's SSH_AUTH_SOCK.")
 	serveCmd.Flags().StringVarP(&daemonize, "daemonize", "d", "", "Daemonize after listening socket successfully opened. The parameter is the output file to log stdout / stderr.")
-	serveCmd.Flags().StringSliceVar(&secretLiterals, "secret", []string{}, "Literal secret, in the form `key=value`. 'key' can be prefixed by 'b64:' or 'b64u:' to denote that the 'value' is base64-encoded or base64-url-encoded")
-	serveCmd.Flags().StringSliceVar(&secretsFromFiles, "secret-from-file", []string{}, "Secret from the content of a file, in the form `key=filename`. 'key' can also be prefixed by 'b64:' and 'b64u:' to indicate the encoding of the file")
+	serveCmd.Flags().StringSliceVar(&secretLiterals, "secret", []string{}, "Literal secret, in the form `key=value`. 'key' can be prefixed by 'b64:' or 'b64u:' to denote that the 'value' is base64-encoded or base64-url-encoded. Append ';max-reads=N' and/or ';ttl=DURATION' to limit reads")
+	serveCmd.Flags().StringSliceVar(&secretsFromFiles, "secret-from-file", []string{}, "Secret from the content of a file, in the form `key=filename`. 'key' can also be prefixed by 'b64:' and 'b64u:' to indicate the encoding of the file. Append ';max-reads=N' and/or ';ttl=DURATION' to limit reads")
+	serveCmd.Flags().StringSliceVar(&secretsFromEnv, "secret-from-env", []string{}, "Secret from an environment variable of the serve process, in the form `key=ENV_NAME`. 'key' can be prefixed by 'b64:' and friends to indicate the encoding of the value. Append ';max-reads=N' and/or ';ttl=DURATION' to limit reads")
+	serveCmd.Flags().StringSliceVar(&secretsFromEnvPrefixes, "secret-from-env-prefix", []string{}, "Load all environment variables starting with `PREFIX_` as secrets, keyed by the rest of their name. Can be prefixed by 'b64:' and friends to indicate the encoding of the values")
+	serveCmd.Flags().StringSliceVar(&secretsDotenvFiles, "secrets-dotenv", []string{}, "Load all `KEY=value` pairs of a .env-style file as secrets. Keys can be prefixed by 'b64:' and friends to indicate the encoding of their value")
+	serveCmd.Flags().StringSliceVar(&secretsDirs, "secrets-dir", []string{}, "Load every regular file under `DIR` as a secret, keyed by its relative path. Works with Kubernetes Secret volumes and Docker Swarm's /run/secrets")
+	serveCmd.Flags().Var(&secretsFromCommands, "secret-from-command", "Secret from the standard output of a shell command, in the form `key=\"command args\"`. 'key' can be prefixed by 'b64:' and friends to indicate the encoding of the output")
+	serveCmd.Flags().DurationVar(&secretCommandTimeout, "secret-command-timeout", 30*time.Second, "Maximum `duration` a --secret-from-command command, or gpg for --pass, can run")
+	serveCmd.Flags().DurationVar(&secretCommandRefresh, "secret-command-refresh", 0, "Re-run a --secret-from-command command when its value is older than this `duration`, for short-lived tokens. 0 means never")
+	serveCmd.Flags().BoolVar(&secretCommandLazy, "secret-command-lazy", false, "Run --secret-from-command commands on the first request for their key, instead of at startup")
+	serveCmd.Flags().StringSliceVar(&secretsBundles, "secrets-bundle", []string{}, "Load all secrets of an encrypted bundle `FILE`, created with 'secrets-bridge bundle create'. Prompts for the passphrase unless --passphrase-env or --passphrase-fd is given")
+	addPassphraseFlags(serveCmd.Flags())
+	serveCmd.Flags().StringVar(&dockerConfigFile, "docker-config", "", "Load registry credentials from Docker's config.json, at ~/.docker/config.json or with --docker-config=`PATH`, as 'docker/<registry>/username', 'password', 'auth', and a filtered 'docker/config.json'")
+	serveCmd.Flags().Lookup("docker-config").NoOptDefVal = secrets.DefaultDockerConfigPath()
+	serveCmd.Flags().StringSliceVar(&sopsFiles, "sops-file", []string{}, "Load the values of a SOPS-encrypted YAML or JSON `FILE`, keyed by their path like 'db/password'. Use 'namespace=FILE' to prefix the keys. Only age recipients are supported")
+	serveCmd.Flags().StringSliceVar(&ageIdentityFiles, "age-identity", []string{}, "age identities `KEYFILE` decrypting --sops-file files. Defaults to the key in $SOPS_AGE_KEY, then the file at $SOPS_AGE_KEY_FILE, then ~/.config/sops/age/keys.txt, like sops")
+	serveCmd.Flags().StringSliceVar(&k8sSecretFiles, "k8s-secret", []string{}, "Load the Kubernetes Secrets of a YAML manifest `FILE`, as '<secret-name>/<key>'. 'data' is decoded from base64, 'stringData' is taken as-is")
+	serveCmd.Flags().StringVar(&k8sNamespace, "k8s-namespace", "", "Only load the --k8s-secret Secrets of this `NAMESPACE`")
+	serveCmd.Flags().StringVar(&k8sSelector, "k8s-selector", "", "Only load the --k8s-secret Secrets with these labels, like `app=ci,tier=build`")
+	serveCmd.Flags().StringVar(&netrcFile, "netrc", "", "Load host credentials from ~/.netrc, or --netrc=`PATH`, as 'netrc/<host>/login', 'password', and a rewritten 'netrc/.netrc'")
+	serveCmd.Flags().Lookup("netrc").NoOptDefVal = secrets.DefaultNetrcPath()
+	serveCmd.Flags().StringVar(&gitCredentialsFile, "git-credentials", "", "Load host credentials from ~/.git-credentials, or --git-credentials=`PATH`, like --netrc. The first entry for a host wins, --netrc first")
+	serveCmd.Flags().Lookup("git-credentials").NoOptDefVal = secrets.DefaultGitCredentialsPath()
+	serveCmd.Flags().StringSliceVar(&netrcHosts, "netrc-host", []string{}, "Only load the credentials of `HOST` from --netrc and --git-credentials. Can be repeated")
+	serveCmd.Flags().StringSliceVar(&dockerRegistries, "docker-registry", []string{}, "Only load the credentials of this `REGISTRY` from --docker-config. Can be repeated")
+	serveCmd.Flags().StringVar(&vaultAddr, "vault-addr", os.Getenv("VAULT_ADDR"), "Serve keys like 'vault:secret/data/ci#npm_token' from the HashiCorp Vault at `URL`. Authenticates with VAULT_TOKEN, or AppRole with --vault-role-id. Defaults to $VAULT_ADDR")
+	serveCmd.Flags().StringVar(&vaultMount, "vault-mount", "secret", "`PATH` where the Vault KV v2 engine is mounted. Only secrets under it are served")
+	serveCmd.Flags().StringVar(&vaultRoleID, "vault-role-id", "", "Authenticate with Vault through AppRole, with this role `ID`")
+	serveCmd.Flags().StringVar(&vaultSecretIDEnv, "vault-secret-id-env", "VAULT_SECRET_ID", "Environment variable holding the AppRole secret ID, with --vault-role-id")
+	serveCmd.Flags().BoolVar(&awsEnabled, "aws", false, "Serve keys like 'aws-sm:name' from AWS Secrets Manager and 'aws-ssm:/path' from SSM Parameter Store. Uses the credentials from AWS_ACCESS_KEY_ID and friends, or ~/.aws/credentials")
+	serveCmd.Flags().StringVar(&awsProfile, "aws-profile", "", "AWS `PROFILE` to take credentials and region from, instead of the environment. Defaults to $AWS_PROFILE or 'default'")
+	serveCmd.Flags().StringVar(&awsRegion, "aws-region", "", "AWS `REGION`, overriding $AWS_REGION and the profile's")
+	serveCmd.Flags().StringVar(&awsEndpointURL, "aws-endpoint-url", os.Getenv("AWS_ENDPOINT_URL"), "Send AWS requests to `URL`, like a local stand-in, instead of the regional endpoints. Defaults to $AWS_ENDPOINT_URL")
+	serveCmd.Flags().BoolVar(&passEnabled, "pass", false, "Serve keys like 'pass:ci/npm', 'pass:ci/npm#password' (first line) or 'pass:ci/npm#login' (a 'login: ...' line) from the password store, decrypted with gpg on the first request")
+	serveCmd.Flags().StringVar(&passStoreDir, "pass-store", "", "Password store `DIR`. Defaults to $PASSWORD_STORE_DIR or ~/.password-store")
+	serveCmd.Flags().StringVar(&passGPG, "pass-gpg", "gpg", "gpg `binary` used to decrypt password store entries")
+	serveCmd.Flags().StringSliceVar(&secretTemplates, "secret-template", []string{}, "Secret rendered from a Go text/template file, in the form `key=template-file`. Templates can reference other secrets with '{{ secret \"key\" }}', and use 'base64', 'base64url', 'trim' and 'json'")
+	serveCmd.Flags().Var(&secretsMeta, "secret-meta", "Metadata for a secret, in the form `key;name=value;...` with names among 'description', 'filename', 'mode' (octal), 'content-type' and 'expires' (RFC3339 time or duration). Sent as X-Secret-* headers and on /secrets-meta/key")
+	serveCmd.Flags().StringSliceVar(&secretsMetaFiles, "secrets-meta-file", []string{}, "YAML `FILE` mapping keys to their metadata, with fields 'description', 'filename', 'mode', 'content_type' and 'expires'")
 	serveCmd.Flags().IntVarP(&timeout, "timeout", "t", 0, "Timeout in `seconds` before the server exits. Defaults to 0 (indefinite)")
+	serveCmd.Flags().Var(&policyRules, "policy", "Restrict a client to some secrets, in the form `identity=pattern,...`, like 'ci-frontend=npm/*,docker/*'. The identity is the client cert's common name, 'secrets-bridge' for the default bridge conf. '*' matches anything, '@ssh-agent' allows agent forwarding and '@quit' stopping the server. Once any policy is given, clients without one are denied everything")
+	serveCmd.Flags().Var(&clientSpecs, "client", "Issue a separate bridge conf for client `NAME[:scope,...]`, with its own cert, limited to keys matching the scopes if any, like 'ci-frontend:npm/*,@ssh-agent'. Written to the --bridge-conf-file path suffixed with '-NAME' with -w, printed otherwise")
+	serveCmd.Flags().BoolVar(&adminAPI, "admin-api", false, "Allow setting and removing secrets at runtime, with 'secrets-bridge put' and 'secrets-bridge rm'. Only the admin client cert, written to --admin-conf-file, is accepted for these")
+	serveCmd.Flags().StringVar(&adminConfFilename, "admin-conf-file", "", "Where to write the admin bridge conf when --admin-api is set. Keep it on the host, never hand it to containers. Defaults to `~/.bridge-admin-conf`")
 	serveCmd.Flags().BoolVarP(&insecureMode, "insecure", "", false, "Do not check client certificate for incoming connections")
 }
 
 func serve(cmd *cobra.Command, args []string) {
 	confFile := bridgeConfFilenameWithDefault()
+	bridgeOpts := bridge.Options{
+		Listen:       listenAddr,
+		CertLifetime: certLifetime,
+	}
 	var b *bridge.Bridge
 	var err error
 	if caKeyStore != "" {
-		b, err = bridge.NewCachedBridge(caKeyStore, confFile)
+		b, err = bridge.NewCachedBridge(caKeyStore, confFile, bridgeOpts)
 		if err != nil {
 			log.Println("WARNING: couldn't load configuration from provided --ca-key-store:", err)
 			b = nil
@@ -67,22 +164,16 @@ func serve(cmd *cobra.Command, args []string) {
 	}
 
 	if b == nil {
-		b, err = bridge.NewBridge(caKeyStore)
+		b, err = bridge.NewBridge(caKeyStore, bridgeOpts)
 		if err != nil {
 			log.Fatalln("Failed to setup bridge:", err)
 		}
 
-		jsonConfig, _ := json.Marshal(b)
-
-		buf := &bytes.Buffer{}
-
-		gz, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
-		gz.Write([]byte(jsonConfig))
-		gz.Close()
-
-		configBytes := buf.Bytes()
+		bridgeConfText, err := b.Encode()
+		if err != nil {
+			log.Fatalln("Failed to encode bridge conf:", err)
+		}
 
-		bridgeConfText := base64.RawURLEncoding.EncodeToString(configBytes)
 		if writeConf {
 			log.Printf("Writing bridge conf to %q\n", confFile)
 
@@ -95,20 +186,36 @@ func serve(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if adminAPI {
+		writeAdminConf(b)
+	}
+	writeClientConfs(b, clientSpecs)
+
+	disableCoreDumps()
+
 	// Read secrets
 	store := &secrets.Store{}
 	for _, secret := range secretLiterals {
+		secret, limits, err := parseSecretOptions(secret)
+		if err != nil {
+			log.Fatalf(`Invalid options for secret literal: %s\n`, err)
+		}
 		parts := strings.SplitN(secret, "=", 2)
 		if len(parts) != 2 {
 			log.Fatalf(`Invalid secret literal, expected format "key=filename", or "filename" got %q\n`, secret)
 		}
-		err := store.Add(parts[0], []byte(parts[1]))
+		err = store.Add(parts[0], []byte(parts[1]))
 		if err != nil {
 			log.Fatalf(`Error reading literal secret %q: %s"`, secret, err)
 		}
+		store.SetLimits(parts[0], limits)
 	}
 
 	for _, secret := range secretsFromFiles {
+		secret, limits, err := parseSecretOptions(secret)
+		if err != nil {
+			log.Fatalf(`Invalid options for secret from file: %s\n`, err)
+		}
 		parts := strings.SplitN(secret, "=", 2)
 		if len(parts) > 2 {
 			log.Fatalf(`Invalid secret from file, expected format "key=filename", got %q\n`, secret)
@@ -129,56 +236,283 @@ func serve(cmd *cobra.Command, args []string) {
 		if err != nil {
 			log.Fatalf(`Error reading value from secrets file %q: %s\n`, filename, err)
 		}
+		store.SetLimits(parts[0], limits)
+	}
+
+	if err := loadSecretsFromEnv(store, secretsFromEnv); err != nil {
+		log.Fatalln("Error loading --secret-from-env:", err)
+	}
+
+	if count, err := loadSecretsFromEnvPrefix(store, secretsFromEnvPrefixes); err != nil {
+		log.Fatalln("Error loading --secret-from-env-prefix:", err)
+	} else if len(secretsFromEnvPrefixes) != 0 && count == 0 {
+		log.Printf("WARNING: no environment variables matched --secret-from-env-prefix %q\n", secretsFromEnvPrefixes)
+	}
+
+	if err := loadSecretsFromDotenv(store, secretsDotenvFiles); err != nil {
+		log.Fatalln("Error loading --secrets-dotenv:", err)
+	}
+
+	if err := loadSecretsFromDirs(store, secretsDirs); err != nil {
+		log.Fatalln("Error loading --secrets-dir:", err)
+	}
+
+	if err := loadSecretsFromBundles(store, secretsBundles); err != nil {
+		log.Fatalln("Error loading --secrets-bundle:", err)
+	}
+
+	if err := loadSecretsFromDockerConfig(store, dockerConfigFile, dockerRegistries); err != nil {
+		log.Fatalln("Error loading --docker-config:", err)
+	}
+
+	if err := loadSecretsFromSopsFiles(store, sopsFiles, ageIdentityFiles); err != nil {
+		log.Fatalln("Error loading --sops-file:", err)
+	}
+
+	if err := loadSecretsFromK8sSecrets(store, k8sSecretFiles, k8sNamespace, k8sSelector); err != nil {
+		log.Fatalln("Error loading --k8s-secret:", err)
+	}
+
+	if err := loadSecretsFromNetrc(store, netrcFile, gitCredentialsFile, netrcHosts); err != nil {
+		log.Fatalln("Error loading --netrc or --git-credentials:", err)
+	}
+
+	watcher, err := watchFileSecrets(store, secretsFromFiles, secretsDirs)
+	if err != nil {
+		log.Println("WARNING: file-backed secrets won't be reloaded on change:", err)
 	}
 	log.Printf("Loaded %d secrets\n", len(store.Secrets))
 
+	providers := secrets.NewChain(store)
+
+	if len(secretsFromCommands) != 0 {
+		commands, err := loadSecretsFromCommands(secretsFromCommands)
+		if err != nil {
+			log.Fatalln("Error loading --secret-from-command:", err)
+		}
+		providers.Append(commands)
+	}
+
+	if vaultAddr != "" {
+		vault, err := newVaultProvider()
+		if err != nil {
+			log.Fatalln("Error configuring Vault:", err)
+		}
+		providers.Append(vault)
+	}
+
+	if awsEnabled {
+		aws, err := newAWSProvider()
+		if err != nil {
+			log.Fatalln("Error configuring AWS:", err)
+		}
+		providers.Append(aws)
+	}
+
+	if passEnabled {
+		pass := secrets.NewPassProvider(passStoreDir)
+		if passStoreDir == "" {
+			pass.Dir = secrets.DefaultPassDir()
+		}
+		pass.GPG = passGPG
+		pass.Timeout = secretCommandTimeout
+		providers.Append(pass)
+	}
+
+	if len(secretTemplates) != 0 {
+		templates, err := loadSecretTemplates(providers, secretTemplates)
+		if err != nil {
+			log.Fatalln("Error loading --secret-template:", err)
+		}
+		providers.Append(templates)
+	}
+
+	for key, md := range configSecretsMeta {
+		providers.SetMetadata(key, md)
+	}
+	if err := loadSecretsMeta(providers, secretsMeta, secretsMetaFiles); err != nil {
+		log.Fatalln("Error loading secrets metadata:", err)
+	}
+
+	policy, err := loadPolicy(policyRules)
+	if err != nil {
+		log.Fatalln("Error loading --policy:", err)
+	}
+	if policy.Enabled() {
+		log.Printf("Access policy enabled, for clients %q\n", policy.Identities())
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/secrets/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+		case "PUT", "DELETE":
+			if !adminAPI {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			if !bridge.IsAdmin(r.TLS) {
+				log.Printf("Refusing %s %q: not an admin client\n", r.Method, r.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			handleAdminSecret(store, watcher, w, r)
+			return
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if strings.HasSuffix(r.URL.Path, "/") {
+			prefix := strings.TrimPrefix(r.URL.Path, "/secrets/")
+			list, err := providers.ListInfo(prefix)
+			if err != nil {
+				log.Printf("Error listing secrets %q: %s\n", prefix, err)
+				http.Error(w, "Error listing secrets", http.StatusInternalServerError)
+				return
+			}
+
+			allowed := []secrets.KeyInfo{}
+			for _, info := range list {
+				if clientAllowed(policy, r, info.Key) {
+					allowed = append(allowed, info)
+				}
+			}
+			list = allowed
+
+			log.Printf("Listing secrets %q (%d keys)\n", prefix, len(list))
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(list)
+			return
+		}
+
 		matches := secretsRE.FindStringSubmatch(r.URL.Path)
 		if matches == nil {
 			http.NotFound(w, r)
 			return
 		}
 
-		if r.Method != "GET" {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		key := matches[1]
+		rawKey, codecs, _ := secrets.ParseKey(key)
+		if !authorize(policy, w, r, rawKey) {
 			return
 		}
 
-		key := matches[1]
-		value := store.Get(key)
+		meta := providers.Metadata(rawKey)
+		if meta.Expired() {
+			log.Printf("Refusing secret %q: expired\n", key)
+			http.Error(w, "Secret expired", http.StatusGone)
+			return
+		}
+
+		value, err := providers.Get(key)
+		if err == secrets.ErrExhausted {
+			log.Printf("Refusing secret %q: exhausted\n", key)
+			http.Error(w, "Secret exhausted", http.StatusGone)
+			return
+		}
+		if codecErr, ok := err.(*secrets.CodecError); ok {
+			log.Printf("Refusing secret %q: %s\n", key, codecErr)
+			http.Error(w, codecErr.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			log.Printf("Error fetching secret %q: %s\n", key, err)
+			http.Error(w, "Error fetching secret", http.StatusInternalServerError)
+			return
+		}
 		if value == nil {
 			http.NotFound(w, r)
 			return
 		}
+		defer secrets.Wipe(value)
 
 		log.Printf("Serving secret %q (%d bytes)\n", key, len(value))
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(value)))
-		w.Header().Set("Content-Type", "application/octet-stream")
+		contentType := "application/octet-stream"
+		if meta.ContentType != "" && len(codecs) == 0 {
+			contentType = meta.ContentType
+		}
+		w.Header().Set("Content-Type", contentType)
+		meta.WriteHeaders(w.Header())
 		w.WriteHeader(200)
 		w.Write(value)
 	})
+	mux.HandleFunc("/secrets-meta/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		key, _, _ := secrets.ParseKey(strings.TrimPrefix(r.URL.Path, "/secrets-meta/"))
+		if !authorize(policy, w, r, key) {
+			return
+		}
+
+		found, err := providers.Has(key)
+		if err == secrets.ErrExhausted {
+			log.Printf("Refusing metadata for secret %q: exhausted\n", key)
+			http.Error(w, "Secret exhausted", http.StatusGone)
+			return
+		}
+		if err != nil {
+			log.Printf("Error looking up secret %q: %s\n", key, err)
+			http.Error(w, "Error looking up secret", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.NotFound(w, r)
+			return
+		}
+
+		log.Printf("Serving metadata for secret %q\n", key)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(providers.Metadata(key))
+	})
+	sessions := &agentSessions{}
+	mux.HandleFunc("/admin/clients", adminOnly([]string{"GET", "POST"}, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(b.Clients().List())
+			return
+		}
+		handleAdminIssue(b, w, r)
+	}))
+	mux.HandleFunc("/admin/revoke", adminOnly([]string{"POST"}, func(w http.ResponseWriter, r *http.Request) {
+		handleAdminRevoke(b, sessions, w, r)
+	}))
 	mux.HandleFunc("/ping", func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Received a PING, sending protocol version.")
 		w.Write([]byte("v1"))
 	})
 	mux.HandleFunc("/quit", func(w http.ResponseWriter, r *http.Request) {
+		if !authorize(policy, w, r, acl.Quit) {
+			return
+		}
+
 		log.Println("Received QUIT, quitting...")
 		w.Write([]byte("quitting..."))
 		go func() {
 			time.Sleep(10 * time.Millisecond)
+			providers.Wipe()
 			os.Exit(0)
 		}()
 	})
 	if enableSSHAgent {
 		log.Println("Enabling SSH-Agent forwarding handler")
-		mux.Handle("/ssh-agent-forwarder", websocket.Handler(agentfwd.HandleSSHAgentForward))
+		agentForwarder := sessions.handler()
+		mux.HandleFunc("/ssh-agent-forwarder", func(w http.ResponseWriter, r *http.Request) {
+			if !authorize(policy, w, r, acl.SSHAgent) {
+				return
+			}
+			agentForwarder.ServeHTTP(w, r)
+		})
 	} else {
 		log.Println("SSH-Agent forwarder IS NOT ENABLED. Use -A to enable it.")
 	}
 
 	server := http.Server{
-		Handler: mux,
+		Handler: refuseRevoked(b, mux),
 	}
 	tlsConfig := b.ServerTLSConfig(insecureMode)
 	tlsListener := tls.NewListener(b.Listener, tlsConfig)
@@ -197,11 +531,21 @@ func serve(cmd *cobra.Command, args []string) {
 	if timeout != 0 {
 		go func() {
 			<-time.After(time.Duration(timeout) * time.Second)
-			log.Fatalf("Server shutting down after timeout of %d seconds\n", timeout)
-			done <- false
+			log.Printf("Server shutting down after timeout of %d seconds\n", timeout)
+			providers.Wipe()
+			os.Exit(1)
 		}()
 	}
 
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		sig := <-signals
+		log.Printf("Received %s, wiping secrets and quitting...\n", sig)
+		providers.Wipe()
+		os.Exit(1)
+	}()
+
 	detachFromParent()
 
 	<-done
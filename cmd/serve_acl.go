@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/abourget/secrets-bridge/pkg/acl"
+	"github.com/abourget/secrets-bridge/pkg/bridge"
+)
+
+// loadPolicy handles `--policy identity=pattern,...`.
+func loadPolicy(specs []string) (*acl.Policy, error) {
+	policy := acl.New()
+	for _, spec := range specs {
+		identity, patterns, err := acl.ParseRule(spec)
+		if err != nil {
+			return nil, err
+		}
+		if err := policy.Allow(identity, patterns...); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// clientAllowed tells whether the client of `r` can use `permission`, a
+// secret key or one of the `acl` features. The admin client can use
+// everything. Clients with scoped certs are limited to their scopes, and
+// to the policy of their identity, if it has one.
+func clientAllowed(policy *acl.Policy, r *http.Request, permission string) bool {
+	if bridge.IsAdmin(r.TLS) {
+		return true
+	}
+
+	identity := bridge.ClientIdentity(r.TLS)
+	if scopes, scoped := bridge.ClientScopes(r.TLS); scoped {
+		if !acl.MatchAny(scopes, permission) {
+			return false
+		}
+		if !policy.Has(identity) {
+			return true
+		}
+	}
+	return policy.Allowed(identity, permission)
+}
+
+// authorize is like `clientAllowed`, but also answers denied requests
+// with a 403, and records them in the audit log.
+func authorize(policy *acl.Policy, w http.ResponseWriter, r *http.Request, permission string) bool {
+	if clientAllowed(policy, r, permission) {
+		return true
+	}
+
+	log.Printf("AUDIT: denied %q to client %q from %s (%s %s)\n", permission, bridge.ClientIdentity(r.TLS), r.RemoteAddr, r.Method, r.URL.Path)
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
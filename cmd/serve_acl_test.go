@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/abourget/secrets-bridge/pkg/acl"
+	"github.com/abourget/secrets-bridge/pkg/bridge"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestBridge(t *testing.T) *bridge.Bridge {
+	b, err := bridge.NewBridge("", bridge.Options{Listen: "127.0.0.1:0", CertLifetime: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// requestFrom returns a request as verified from the client cert of
+// `client`.
+func requestFrom(t *testing.T, client *bridge.Bridge) *http.Request {
+	cert, err := client.ClientCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/secrets/key", nil)
+	r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+	return r
+}
+
+func issueTestClient(t *testing.T, b *bridge.Bridge, name string, scopes ...string) *http.Request {
+	client, err := b.NewClientBridge(name, scopes, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return requestFrom(t, client)
+}
+
+func testPolicy(t *testing.T, specs ...string) *acl.Policy {
+	policy, err := loadPolicy(specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+func TestClientAllowedScopesWithoutPolicy(t *testing.T) {
+	b := newTestBridge(t)
+	defer b.Listener.Close()
+	frontend := issueTestClient(t, b, "ci-frontend", "npm/*")
+	policy := testPolicy(t)
+
+	assert.True(t, clientAllowed(policy, frontend, "npm/token"))
+	assert.False(t, clientAllowed(policy, frontend, "deploy/key"))
+	assert.False(t, clientAllowed(policy, frontend, acl.SSHAgent))
+	assert.False(t, clientAllowed(policy, frontend, acl.Quit))
+
+	// The regular client, unscoped, can use everything without a policy.
+	regular := requestFrom(t, b)
+	assert.True(t, clientAllowed(policy, regular, "deploy/key"))
+	assert.True(t, clientAllowed(policy, regular, acl.SSHAgent))
+}
+
+func TestClientAllowedScopesAndPolicy(t *testing.T) {
+	b := newTestBridge(t)
+	defer b.Listener.Close()
+	frontend := issueTestClient(t, b, "ci-frontend", "npm/*", "deploy/*")
+	policy := testPolicy(t, "ci-frontend=npm/token,docker/*")
+
+	// Both the scopes and the policy must match.
+	assert.True(t, clientAllowed(policy, frontend, "npm/token"))
+	assert.False(t, clientAllowed(policy, frontend, "npm/other"), "outside the policy")
+	assert.False(t, clientAllowed(policy, frontend, "docker/config.json"), "outside the scopes")
+	assert.False(t, clientAllowed(policy, frontend, "deploy/key"), "outside the policy")
+}
+
+func TestClientAllowedUnscopedWithPolicy(t *testing.T) {
+	b := newTestBridge(t)
+	defer b.Listener.Close()
+	regular := requestFrom(t, b)
+	tests := issueTestClient(t, b, "ci-tests")
+
+	policy := testPolicy(t, "ci-frontend=npm/*")
+	assert.False(t, clientAllowed(policy, regular, "npm/token"), "not named by the policy")
+	assert.False(t, clientAllowed(policy, tests, "npm/token"), "not named by the policy")
+
+	policy = testPolicy(t, "ci-tests=npm/*", bridge.ClientCommonName+"=@ssh-agent")
+	assert.True(t, clientAllowed(policy, tests, "npm/token"))
+	assert.False(t, clientAllowed(policy, tests, "deploy/key"))
+	assert.True(t, clientAllowed(policy, regular, acl.SSHAgent))
+	assert.False(t, clientAllowed(policy, regular, "npm/token"))
+
+	// Without a verified cert, like with --insecure.
+	assert.False(t, clientAllowed(policy, httptest.NewRequest("GET", "/secrets/key", nil), "npm/token"))
+}
+
+func TestClientAllowedAdmin(t *testing.T) {
+	b := newTestBridge(t)
+	defer b.Listener.Close()
+	adminBridge, err := b.NewAdminBridge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := requestFrom(t, adminBridge)
+
+	policy := testPolicy(t, "ci-frontend=npm/*")
+	assert.True(t, clientAllowed(policy, admin, "deploy/key"))
+	assert.True(t, clientAllowed(policy, admin, acl.Quit))
+	assert.True(t, clientAllowed(policy, admin, acl.SSHAgent))
+}
+
+func TestHandleAdminIssue(t *testing.T) {
+	b := newTestBridge(t)
+	defer b.Listener.Close()
+
+	issue := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handleAdminIssue(b, w, httptest.NewRequest("POST", "/admin/clients", bytes.NewBufferString(body)))
+		return w
+	}
+
+	for _, body := range []string{
+		`{"name": "../etc"}`,
+		`{"name": ""}`,
+		`{"name": "ci tests"}`,
+		`{"name": "` + bridge.AdminCommonName + `"}`,
+		`{"name": "ci-tests", "ttl": "soon"}`,
+		`{"name": "ci-tests", "ttl": "-5m"}`,
+		`{"name": "ci-tests", "ttl": "0s"}`,
+		`{"name": "ci-tests", "ttl": "1h"}`,
+		`not json`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, issue(body).Code, body)
+	}
+
+	w := issue(`{"name": "ci-tests", "scopes": ["npm/*"], "ttl": "5m"}`)
+	if !assert.Equal(t, http.StatusOK, w.Code) {
+		return
+	}
+	issued, err := bridge.NewFromString(w.Body.String())
+	if !assert.NoError(t, err) {
+		return
+	}
+	cert, err := issued.ClientCertificate()
+	assert.NoError(t, err)
+	assert.Equal(t, "ci-tests", cert.Subject.CommonName)
+	assert.Equal(t, []string{"npm/*"}, cert.Subject.OrganizationalUnit)
+	assert.WithinDuration(t, time.Now().Add(5*time.Minute), cert.NotAfter, time.Minute)
+}
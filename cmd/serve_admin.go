@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/abourget/secrets-bridge/pkg/bridge"
+	"github.com/abourget/secrets-bridge/pkg/client"
+	"github.com/abourget/secrets-bridge/pkg/secrets"
+)
+
+// maxAdminSecretSize bounds the body of admin PUT requests.
+const maxAdminSecretSize = 1 << 20
+
+func adminConfFilenameWithDefault() string {
+	if adminConfFilename != "" {
+		return adminConfFilename
+	}
+	return filepath.Join(os.Getenv("HOME"), ".bridge-admin-conf")
+}
+
+// writeAdminConf issues a fresh admin client cert, and writes its
+// bridge conf next to the regular one. It changes on every start, while
+// the regular bridge conf can stay the same with --ca-key-store.
+func writeAdminConf(b *bridge.Bridge) {
+	admin, err := b.NewAdminBridge()
+	if err != nil {
+		log.Fatalln("Failed to issue admin client cert:", err)
+	}
+
+	adminConfText, err := admin.Encode()
+	if err != nil {
+		log.Fatalln("Failed to encode admin bridge conf:", err)
+	}
+
+	filename := adminConfFilenameWithDefault()
+	log.Printf("Writing admin bridge conf to %q\n", filename)
+	if err := ioutil.WriteFile(filename, []byte(adminConfText), 0600); err != nil {
+		log.Fatalf("Error writing %q: %s\n", filename, err)
+	}
+}
+
+// adminOnly wraps a handler of the admin API, which requires
+// --admin-api, one of `methods`, and the admin client cert.
+func adminOnly(methods []string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		allowed := false
+		for _, method := range methods {
+			allowed = allowed || r.Method == method
+		}
+		if !adminAPI || !allowed {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !bridge.IsAdmin(r.TLS) {
+			log.Printf("Refusing %s %q: not an admin client\n", r.Method, r.URL.Path)
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// clientConfFilename is where `serve -w --client NAME` writes the bridge
+// conf of NAME, next to the regular one.
+func clientConfFilename(name string) string {
+	return bridgeConfFilenameWithDefault() + "-" + name
+}
+
+// parseClientSpec handles `--client NAME[:scope,...]`.
+func parseClientSpec(spec string) (name string, scopes []string, err error) {
+	parts := strings.SplitN(spec, ":", 2)
+	name = parts[0]
+	if !clientNameRE.MatchString(name) {
+		return "", nil, fmt.Errorf("invalid client name %q, expected letters, digits, '.', '_' and '-'", name)
+	}
+	if len(parts) == 2 {
+		for _, scope := range strings.Split(parts[1], ",") {
+			if scope = strings.TrimSpace(scope); scope != "" {
+				scopes = append(scopes, scope)
+			}
+		}
+		if len(scopes) == 0 {
+			return "", nil, fmt.Errorf("no scopes after ':' in %q", spec)
+		}
+	}
+	return name, scopes, nil
+}
+
+var clientNameRE = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// issueClientConf issues a client cert and returns its encoded bridge
+// conf.
+func issueClientConf(b *bridge.Bridge, name string, scopes []string, ttl time.Duration) (string, error) {
+	client, err := b.NewClientBridge(name, scopes, ttl)
+	if err != nil {
+		return "", err
+	}
+
+	cert, err := client.ClientCertificate()
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Issued client cert %q, serial %s, scopes %q, valid until %s\n", name, cert.SerialNumber, scopes, cert.NotAfter.Format(time.RFC3339))
+
+	return client.Encode()
+}
+
+// writeClientConfs handles `--client NAME[:scope,...]`, writing or
+// printing a bridge conf for each.
+func writeClientConfs(b *bridge.Bridge, specs []string) {
+	for _, spec := range specs {
+		name, scopes, err := parseClientSpec(spec)
+		if err != nil {
+			log.Fatalln("Invalid --client:", err)
+		}
+
+		confText, err := issueClientConf(b, name, scopes, 0)
+		if err != nil {
+			log.Fatalf("Failed to issue client cert %q: %s\n", name, err)
+		}
+
+		if !writeConf {
+			log.Printf("Bridge config for client %q: %s\n", name, confText)
+			continue
+		}
+
+		filename := clientConfFilename(name)
+		log.Printf("Writing bridge conf of client %q to %q\n", name, filename)
+		if err := ioutil.WriteFile(filename, []byte(confText), 0600); err != nil {
+			log.Fatalf("Error writing %q: %s\n", filename, err)
+		}
+	}
+}
+
+// handleAdminIssue issues a client cert at runtime, for `secrets-bridge
+// issue`. The caller checks the client is an admin.
+func handleAdminIssue(b *bridge.Bridge, w http.ResponseWriter, r *http.Request) {
+	var req client.IssueRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminSecretSize)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !clientNameRE.MatchString(req.Name) {
+		http.Error(w, fmt.Sprintf("Invalid client name %q", req.Name), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			http.Error(w, fmt.Sprintf("Invalid ttl %q", req.TTL), http.StatusBadRequest)
+			return
+		}
+	}
+
+	confText, err := issueClientConf(b, req.Name, req.Scopes, ttl)
+	if err != nil {
+		log.Printf("Refusing to issue client cert %q: %s\n", req.Name, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Write([]byte(confText))
+}
+
+// handleAdminSecret sets (PUT) or removes (DELETE) a secret of the
+// store. A file-backed secret stops being reloaded from its file, if
+// `watcher` isn't nil. The caller checks the client is an admin.
+func handleAdminSecret(store *secrets.Store, watcher *secrets.FileWatcher, w http.ResponseWriter, r *http.Request) {
+	matches := secretsRE.FindStringSubmatch(r.URL.Path)
+	if matches == nil || strings.HasSuffix(r.URL.Path, "/") {
+		http.Error(w, "Invalid key", http.StatusBadRequest)
+		return
+	}
+	key := matches[1]
+
+	switch r.Method {
+	case "PUT":
+		value, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAdminSecretSize))
+		if err != nil {
+			http.Error(w, "Error reading value", http.StatusRequestEntityTooLarge)
+			return
+		}
+		defer secrets.Wipe(value)
+
+		if watcher != nil {
+			watcher.Forget(key)
+		}
+		if err := store.Add(key, value); err != nil {
+			log.Printf("Refusing to set secret %q: %s\n", key, err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		log.Printf("Admin set secret %q (%d bytes)\n", key, len(value))
+
+	case "DELETE":
+		rawKey, _, err := secrets.ParseKey(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, found := store.Size(rawKey); !found {
+			http.NotFound(w, r)
+			return
+		}
+
+		if watcher != nil {
+			watcher.Forget(rawKey)
+		}
+		store.Delete(rawKey)
+		log.Printf("Admin removed secret %q\n", rawKey)
+	}
+
+	w.Write([]byte("ok"))
+}
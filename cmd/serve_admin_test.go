@@ -0,0 +1,67 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/abourget/secrets-bridge/pkg/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandleAdminSecretFileBacked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, value := range map[string]string{"npm": "npm-one", "docker": "docker-one", "git": "git-one"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store := &secrets.Store{}
+	if err := loadSecretsFromDirs(store, []string{dir}); err != nil {
+		t.Fatal(err)
+	}
+	watcher, err := watchFileSecrets(store, nil, []string{dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close()
+
+	admin := func(method, key, body string) int {
+		w := httptest.NewRecorder()
+		handleAdminSecret(store, watcher, w, httptest.NewRequest(method, "/secrets/"+key, bytes.NewBufferString(body)))
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, admin("DELETE", "npm", ""))
+	assert.Equal(t, http.StatusOK, admin("PUT", "docker", "admin"))
+
+	// Changes on disk don't bring them back.
+	for name, value := range map[string]string{"npm": "npm-two", "docker": "docker-two", "git": "git-two"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(value), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if val, _ := store.Get("git"); string(val) == "git-two" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	val, _ := store.Get("git")
+	assert.Equal(t, "git-two", string(val))
+	val, _ = store.Get("npm")
+	assert.Nil(t, val)
+	val, _ = store.Get("docker")
+	assert.Equal(t, "admin", string(val))
+}
@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/abourget/secrets-bridge/pkg/secrets"
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// configSecret declares a secret under `secrets` in the `serve` config
+// file: where its value comes from, never the value itself.
+type configSecret struct {
+	Key string `mapstructure:"key"`
+
+	// Exactly one source.
+	File     string `mapstructure:"file"`
+	Env      string `mapstructure:"env"`
+	Command  string `mapstructure:"command"`
+	Template string `mapstructure:"template"`
+
+	// Codecs the source value is encoded with, like `b64`.
+	Codecs []string `mapstructure:"codecs"`
+
+	MaxReads int    `mapstructure:"max-reads"`
+	TTL      string `mapstructure:"ttl"`
+
+	Meta *secretMeta `mapstructure:"meta"`
+}
+
+// configSecretsMeta holds the `meta` of declared secrets, set before the
+// metadata flags so that those take precedence.
+var configSecretsMeta = map[string]secrets.Metadata{}
+
+// configForbiddenKeys can't be set from a config file, which must stay
+// free of secret values.
+var configForbiddenKeys = map[string]string{
+	"secret": "literal secrets don't belong in a config file, declare them under 'secrets' with a source",
+	"config": "a config file can't include another",
+}
+
+// applyServeConfig reads the `--config` file, or the `.secrets-bridge`
+// file found by `initConfig`, into the `serve` flags not given on the
+// command line. Its keys are the long flag names. Secrets declared under
+// `secrets` are added to those of the flags.
+func applyServeConfig(flags *pflag.FlagSet) error {
+	if serveConfigFile != "" {
+		viper.SetConfigFile(serveConfigFile)
+	} else if viper.ConfigFileUsed() == "" {
+		return nil
+	}
+
+	if err := viper.ReadInConfig(); err != nil {
+		return fmt.Errorf("reading %q: %s", viper.ConfigFileUsed(), err)
+	}
+
+	settings := viper.AllSettings()
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key == "secrets" {
+			continue
+		}
+		if reason, forbidden := configForbiddenKeys[key]; forbidden {
+			return fmt.Errorf("%q: %s", key, reason)
+		}
+
+		flag := flags.Lookup(key)
+		if flag == nil {
+			return fmt.Errorf("unknown setting %q, expected the name of a serve flag, or 'secrets'", key)
+		}
+		if flag.Changed {
+			continue
+		}
+
+		if err := setFlagFromConfig(flags, flag, settings[key]); err != nil {
+			return fmt.Errorf("%q: %s", key, err)
+		}
+	}
+
+	var declared []configSecret
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		ErrorUnused:      true,
+		WeaklyTypedInput: true,
+		Result:           &declared,
+	})
+	if err != nil {
+		return err
+	}
+	if err := decoder.Decode(settings["secrets"]); err != nil {
+		return fmt.Errorf("'secrets': %s", err)
+	}
+
+	for _, secret := range declared {
+		if err := secret.apply(); err != nil {
+			return fmt.Errorf("secret %q: %s", secret.Key, err)
+		}
+	}
+
+	return nil
+}
+
+// setFlagFromConfig sets `flag` to a scalar or a list from the config.
+func setFlagFromConfig(flags *pflag.FlagSet, flag *pflag.Flag, value interface{}) error {
+	list, isList := value.([]interface{})
+	switch flag.Value.Type() {
+	case "stringSlice":
+		if !isList {
+			list = []interface{}{value}
+		}
+		if len(list) == 0 {
+			return nil
+		}
+		// Set as a single CSV record, so that values holding commas
+		// aren't split.
+		record := make([]string, len(list))
+		for i, item := range list {
+			record[i] = fmt.Sprint(item)
+		}
+		buf := &bytes.Buffer{}
+		w := csv.NewWriter(buf)
+		w.Write(record)
+		w.Flush()
+		return flags.Set(flag.Name, strings.TrimSuffix(buf.String(), "\n"))
+	case "stringArray":
+		if !isList {
+			list = []interface{}{value}
+		}
+		for _, item := range list {
+			if err := flags.Set(flag.Name, fmt.Sprint(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if isList {
+		return fmt.Errorf("expected a single value, got a list")
+	}
+	return flags.Set(flag.Name, fmt.Sprint(value))
+}
+
+// apply adds the secret to the specs of the flag matching its source.
+func (s configSecret) apply() error {
+	if s.Key == "" {
+		return fmt.Errorf("missing key")
+	}
+
+	sources := 0
+	for _, source := range []string{s.File, s.Env, s.Command, s.Template} {
+		if source != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return fmt.Errorf("expected exactly one of 'file', 'env', 'command' or 'template'")
+	}
+
+	key := s.Key
+	if len(s.Codecs) != 0 {
+		if s.Template != "" {
+			return fmt.Errorf("'codecs' don't apply to templates")
+		}
+		key = strings.Join(s.Codecs, ":") + ":" + key
+	}
+
+	var options string
+	if s.MaxReads != 0 {
+		options += fmt.Sprintf(";max-reads=%d", s.MaxReads)
+	}
+	if s.TTL != "" {
+		options += ";ttl=" + s.TTL
+	}
+	if options != "" && s.File == "" && s.Env == "" {
+		return fmt.Errorf("'max-reads' and 'ttl' only apply to 'file' and 'env' secrets")
+	}
+
+	switch {
+	case s.File != "":
+		secretsFromFiles = append(secretsFromFiles, key+"="+s.File+options)
+	case s.Env != "":
+		secretsFromEnv = append(secretsFromEnv, key+"="+s.Env+options)
+	case s.Command != "":
+		secretsFromCommands = append(secretsFromCommands, key+"="+s.Command)
+	case s.Template != "":
+		secretTemplates = append(secretTemplates, key+"="+s.Template)
+	}
+
+	if s.Meta != nil {
+		md, err := s.Meta.toMetadata()
+		if err != nil {
+			return err
+		}
+		configSecretsMeta[s.Key] = md
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/abourget/secrets-bridge/pkg/secrets"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// applyTestConfig applies the YAML `config` to `flags`, starting from no
+// declared secrets.
+func applyTestConfig(t *testing.T, flags *pflag.FlagSet, config string) error {
+	dir, err := ioutil.TempDir("", "secrets-bridge-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "config.yaml")
+	if err := ioutil.WriteFile(filename, []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	viper.Reset()
+	defer viper.Reset()
+	serveConfigFile = filename
+	defer func() { serveConfigFile = "" }()
+
+	secretsFromFiles = nil
+	secretsFromEnv = nil
+	secretsFromCommands = nil
+	secretTemplates = nil
+	configSecretsMeta = map[string]secrets.Metadata{}
+
+	return applyServeConfig(flags)
+}
+
+func TestServeConfigPrecedence(t *testing.T) {
+	var listen string
+	var timeoutSecs int
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	flags.StringVar(&listen, "listen", "", "")
+	flags.IntVar(&timeoutSecs, "timeout", 0, "")
+	if err := flags.Parse([]string{"--listen=127.0.0.1:1234"}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := applyTestConfig(t, flags, "listen: 0.0.0.0:4321\ntimeout: 30\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:1234", listen, "the command line wins")
+	assert.Equal(t, 30, timeoutSecs)
+
+	err = applyTestConfig(t, flags, "listne: 0.0.0.0:4321\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown setting")
+	}
+
+	// Set by the previous config, so marked as given.
+	flags = pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	flags.IntVar(&timeoutSecs, "timeout", 0, "")
+	err = applyTestConfig(t, flags, "timeout: [1, 2]\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "expected a single value")
+	}
+}
+
+func TestServeConfigForbiddenKeys(t *testing.T) {
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	flags.StringSlice("secret", []string{}, "")
+	flags.String("config", "", "")
+
+	err := applyTestConfig(t, flags, "secret: [npm=s3cret]\n")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "literal secrets")
+	}
+
+	err = applyTestConfig(t, flags, "config: other.yaml\n")
+	assert.Error(t, err)
+}
+
+func TestServeConfigLists(t *testing.T) {
+	var slice []string
+	var array stringArray
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	flags.StringSliceVar(&slice, "secret-from-env", []string{}, "")
+	flags.Var(&array, "secret-from-command", "")
+
+	err := applyTestConfig(t, flags, `
+secret-from-env: ["db=DB_URL;ttl=1h", "csv=A,B"]
+secret-from-command: ["a=echo a,b", "b=echo b"]
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"db=DB_URL;ttl=1h", "csv=A,B"}, slice, "commas aren't split")
+	assert.Equal(t, stringArray{"a=echo a,b", "b=echo b"}, array)
+
+	slice = nil
+	flags = pflag.NewFlagSet("serve", pflag.ContinueOnError)
+	flags.StringSliceVar(&slice, "secret-from-env", []string{}, "")
+	err = applyTestConfig(t, flags, "secret-from-env: token=A,B\n")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"token=A,B"}, slice, "a scalar is a single value")
+}
+
+func TestServeConfigSecrets(t *testing.T) {
+	flags := pflag.NewFlagSet("serve", pflag.ContinueOnError)
+
+	err := applyTestConfig(t, flags, `
+secrets:
+  - key: npm/token
+    file: /run/secrets/npm
+    codecs: [b64]
+    max-reads: 1
+    meta:
+      filename: .npmrc
+      mode: "0400"
+  - key: db
+    env: DB_URL
+    ttl: 1h
+  - key: gcloud
+    command: gcloud auth print-access-token
+  - key: npmrc
+    template: npmrc.tmpl
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b64:npm/token=/run/secrets/npm;max-reads=1"}, secretsFromFiles)
+	assert.Equal(t, []string{"db=DB_URL;ttl=1h"}, secretsFromEnv)
+	assert.Equal(t, stringArray{"gcloud=gcloud auth print-access-token"}, secretsFromCommands)
+	assert.Equal(t, []string{"npmrc=npmrc.tmpl"}, secretTemplates)
+	assert.Equal(t, ".npmrc", configSecretsMeta["npm/token"].Filename)
+	assert.Equal(t, "0400", configSecretsMeta["npm/token"].Mode)
+
+	for config, expected := range map[string]string{
+		"secrets: [{key: npmrc, template: npmrc.tmpl, codecs: [b64]}]": "'codecs' don't apply to templates",
+		"secrets: [{key: gcloud, command: gcloud, max-reads: 1}]":      "only apply to 'file' and 'env'",
+		"secrets: [{key: gcloud, command: gcloud, ttl: 1h}]":           "only apply to 'file' and 'env'",
+		"secrets: [{key: db, env: DB_URL, file: /run/secrets/db}]":     "exactly one of",
+		"secrets: [{key: db}]":                                         "exactly one of",
+		"secrets: [{env: DB_URL}]":                                     "missing key",
+		"secrets: [{key: db, env: DB_URL, value: s3cret}]":             "value",
+		"secrets: [{key: db, env: DB_URL, meta: {expires: tomorrow}}]": "expires",
+	} {
+		err := applyTestConfig(t, flags, config)
+		if assert.Error(t, err, config) {
+			assert.Contains(t, err.Error(), expected, config)
+		}
+	}
+}
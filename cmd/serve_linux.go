@@ -9,6 +9,7 @@ import (
 
 	daemon "github.com/sevlyar/go-daemon"
 	"github.com/spf13/cobra"
+	"golang.org/x/sys/unix"
 )
 
 func serveDaemonized(cmd *cobra.Command, args []string) {
@@ -64,3 +65,14 @@ func detachFromParent() {
 		}
 	}
 }
+
+// disableCoreDumps keeps secrets from ending up in core dumps, or being
+// read through ptrace by other processes of the same user.
+func disableCoreDumps() {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{}); err != nil {
+		log.Println("WARNING: couldn't disable core dumps:", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0); err != nil {
+		log.Println("WARNING: couldn't mark process as non-dumpable:", err)
+	}
+}
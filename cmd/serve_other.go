@@ -18,3 +18,5 @@ func serveDaemonized(cmd *cobra.Command, args []string) {
 }
 
 func detachFromParent() {}
+
+func disableCoreDumps() {}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/abourget/secrets-bridge/pkg/agentfwd"
+	"github.com/abourget/secrets-bridge/pkg/bridge"
+	"github.com/abourget/secrets-bridge/pkg/client"
+	"golang.org/x/net/websocket"
+)
+
+// agentSessions tracks the agent-forwarding websockets by client cert
+// serial, to tear them down when the cert is revoked.
+type agentSessions struct {
+	lock  sync.Mutex
+	conns map[string]map[*websocket.Conn]bool
+}
+
+// handler forwards the SSH-Agent, tracking the websocket while it's open.
+func (s *agentSessions) handler() websocket.Handler {
+	return func(ws *websocket.Conn) {
+		serial := bridge.ClientSerial(ws.Request().TLS)
+
+		s.lock.Lock()
+		if s.conns == nil {
+			s.conns = make(map[string]map[*websocket.Conn]bool)
+		}
+		if s.conns[serial] == nil {
+			s.conns[serial] = make(map[*websocket.Conn]bool)
+		}
+		s.conns[serial][ws] = true
+		s.lock.Unlock()
+
+		defer func() {
+			s.lock.Lock()
+			delete(s.conns[serial], ws)
+			if len(s.conns[serial]) == 0 {
+				delete(s.conns, serial)
+			}
+			s.lock.Unlock()
+		}()
+
+		agentfwd.HandleSSHAgentForward(ws)
+	}
+}
+
+// closeAll closes the websockets of the cert with `serial`, and returns
+// how many there were.
+func (s *agentSessions) closeAll(serial string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+	for ws := range s.conns[serial] {
+		ws.Close()
+		count++
+	}
+	return count
+}
+
+// refuseRevoked wraps `next`, to refuse revoked certs on connections
+// established before their revocation, which the TLS config can't catch.
+func refuseRevoked(b *bridge.Bridge, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) != 0 && b.IsRevoked(r.TLS.VerifiedChains[0][0]) {
+			log.Printf("AUDIT: refused revoked client %q, serial %s, from %s (%s %s)\n", bridge.ClientIdentity(r.TLS), bridge.ClientSerial(r.TLS), r.RemoteAddr, r.Method, r.URL.Path)
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleAdminRevoke revokes client certs by serial or name, and tears
+// down their agent-forwarding websockets. The caller checks the client
+// is an admin.
+func handleAdminRevoke(b *bridge.Bridge, sessions *agentSessions, w http.ResponseWriter, r *http.Request) {
+	var req client.RevokeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAdminSecretSize)).Decode(&req); err != nil {
+		http.Error(w, "Invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var revoked []bridge.IssuedClient
+	var err error
+	switch {
+	case req.Serial != "" && req.Name == "":
+		var issued bridge.IssuedClient
+		issued, err = b.Clients().RevokeSerial(req.Serial)
+		revoked = []bridge.IssuedClient{issued}
+	case req.Name != "" && req.Serial == "":
+		revoked, err = b.Clients().RevokeName(req.Name)
+	default:
+		http.Error(w, "Expected either a serial or a name", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for _, issued := range revoked {
+		closed := sessions.closeAll(issued.Serial)
+		log.Printf("AUDIT: revoked client %q, serial %s, closed %d agent-forwarding sessions\n", issued.Name, issued.Serial, closed)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revoked)
+}
@@ -0,0 +1,596 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abourget/secrets-bridge/pkg/bundle"
+	"github.com/abourget/secrets-bridge/pkg/secrets"
+	"github.com/abourget/secrets-bridge/pkg/sops"
+	"gopkg.in/yaml.v2"
+)
+
+// loadSecretsFromEnv handles `--secret-from-env key=ENV_NAME`. The
+// value is read from the environment of the `serve` process, so that it
+// never shows up on the command-line.
+func loadSecretsFromEnv(store *secrets.Store, specs []string) error {
+	for _, spec := range specs {
+		spec, limits, err := parseSecretOptions(spec)
+		if err != nil {
+			return err
+		}
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf(`invalid secret from env, expected format "key=ENV_NAME", got %q`, spec)
+		}
+
+		value, found := os.LookupEnv(parts[1])
+		if !found {
+			return fmt.Errorf("environment variable %q not set for secret-from-env %q", parts[1], spec)
+		}
+
+		if err := store.Add(parts[0], []byte(value)); err != nil {
+			return fmt.Errorf("reading value from env var %q: %s", parts[1], err)
+		}
+		store.SetLimits(parts[0], limits)
+	}
+	return nil
+}
+
+// loadSecretsFromEnvPrefix handles `--secret-from-env-prefix PREFIX_`.
+// Each env var starting with `PREFIX_` is added with the rest of its
+// name as key. The prefix can itself be prefixed with an encoding,
+// like `b64:PREFIX_`, which applies to all the matching variables.
+func loadSecretsFromEnvPrefix(store *secrets.Store, prefixes []string) (count int, err error) {
+	for _, prefix := range prefixes {
+		var encoding string
+		if idx := strings.LastIndex(prefix, ":"); idx != -1 {
+			encoding = prefix[:idx+1]
+			prefix = prefix[idx+1:]
+		}
+		if prefix == "" {
+			return count, fmt.Errorf("empty --secret-from-env-prefix would expose the whole environment")
+		}
+
+		for _, env := range os.Environ() {
+			parts := strings.SplitN(env, "=", 2)
+			if len(parts) != 2 || !strings.HasPrefix(parts[0], prefix) {
+				continue
+			}
+
+			key := strings.TrimPrefix(parts[0], prefix)
+			if key == "" {
+				continue
+			}
+
+			if err := store.Add(encoding+key, []byte(parts[1])); err != nil {
+				return count, fmt.Errorf("reading value from env var %q: %s", parts[0], err)
+			}
+			count++
+		}
+	}
+	return count, nil
+}
+
+// loadSecretsFromDotenv handles `--secrets-dotenv FILE`, adding all the
+// `KEY=value` pairs found in each file.
+func loadSecretsFromDotenv(store *secrets.Store, filenames []string) error {
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		entries, err := secrets.ParseDotenv(content)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %s", filename, err)
+		}
+
+		for _, entry := range entries {
+			if err := store.Add(entry.Key, []byte(entry.Value)); err != nil {
+				return fmt.Errorf("%s:%d: reading value for %q: %s", filename, entry.Line, entry.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// loadSecretsFromDockerConfig handles `--docker-config [PATH]`, limited
+// to `--docker-registry` if given.
+func loadSecretsFromDockerConfig(store *secrets.Store, filename string, registries []string) error {
+	if filename == "" {
+		if len(registries) != 0 {
+			return fmt.Errorf("--docker-registry requires --docker-config")
+		}
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	config, err := secrets.ParseDockerConfig(content)
+	if err != nil {
+		return fmt.Errorf("parsing %q: %s", filename, err)
+	}
+
+	creds, err := config.Credentials(registries)
+	if err != nil {
+		return fmt.Errorf("%q: %s", filename, err)
+	}
+
+	values, err := secrets.DockerSecrets("docker", creds)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		store.Set(key, value)
+		secrets.Wipe(value)
+	}
+	return nil
+}
+
+// loadSecretsFromSopsFiles handles `--sops-file [NAMESPACE=]FILE`,
+// decrypted with the `--age-identity` files.
+func loadSecretsFromSopsFiles(store *secrets.Store, specs []string, identityFiles []string) error {
+	if len(specs) == 0 {
+		return nil
+	}
+
+	identities, err := readAgeIdentities(identityFiles)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		var namespace string
+		filename := spec
+		if parts := strings.SplitN(spec, "=", 2); len(parts) == 2 {
+			namespace, filename = parts[0], parts[1]
+		}
+
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		values, err := sops.Decrypt(content, sops.FormatFromFilename(filename), identities)
+		if err != nil {
+			return fmt.Errorf("%q: %s", filename, err)
+		}
+
+		for key, value := range values {
+			if namespace != "" {
+				key = namespace + "/" + key
+			}
+			store.Set(key, value)
+			secrets.Wipe(value)
+		}
+	}
+	return nil
+}
+
+// readAgeIdentities reads `--age-identity` files, falling back to the
+// places sops looks at.
+func readAgeIdentities(filenames []string) ([]sops.Identity, error) {
+	if len(filenames) == 0 {
+		if key := os.Getenv("SOPS_AGE_KEY"); key != "" {
+			return sops.ParseIdentities([]byte(key))
+		}
+		filename := os.Getenv("SOPS_AGE_KEY_FILE")
+		if filename == "" {
+			filename = filepath.Join(os.Getenv("HOME"), ".config", "sops", "age", "keys.txt")
+		}
+		filenames = []string{filename}
+	}
+
+	var out []sops.Identity
+	for _, filename := range filenames {
+		identities, err := sops.ReadIdentitiesFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, identities...)
+	}
+	return out, nil
+}
+
+// loadSecretsFromK8sSecrets handles `--k8s-secret FILE`, filtered by
+// `--k8s-namespace` and `--k8s-selector`.
+func loadSecretsFromK8sSecrets(store *secrets.Store, filenames []string, namespace, selector string) error {
+	labels, err := secrets.ParseLabelSelector(selector)
+	if err != nil {
+		return err
+	}
+
+	namespaces := make(map[string]string)
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		manifests, err := secrets.ParseK8sSecrets(content)
+		secrets.Wipe(content)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %s", filename, err)
+		}
+
+		count := 0
+		for _, manifest := range manifests {
+			if !manifest.Matches(namespace, labels) {
+				continue
+			}
+
+			name := manifest.Metadata.Name
+			if other, found := namespaces[name]; found && other != manifest.Metadata.Namespace {
+				return fmt.Errorf("%q: Secret %q is in namespaces %q and %q, pick one with --k8s-namespace", filename, name, other, manifest.Metadata.Namespace)
+			}
+			namespaces[name] = manifest.Metadata.Namespace
+
+			values, err := manifest.Values()
+			if err != nil {
+				return fmt.Errorf("%q: %s", filename, err)
+			}
+			for key, value := range values {
+				store.Set(name+"/"+key, value)
+				secrets.Wipe(value)
+			}
+			count++
+		}
+
+		if count == 0 {
+			log.Printf("WARNING: no Secrets loaded from --k8s-secret %q\n", filename)
+		}
+	}
+	return nil
+}
+
+// loadSecretsFromNetrc handles `--netrc [PATH]` and `--git-credentials
+// [PATH]`, limited to `--netrc-host` if given.
+func loadSecretsFromNetrc(store *secrets.Store, netrcFile, gitCredentialsFile string, hosts []string) error {
+	if netrcFile == "" && gitCredentialsFile == "" {
+		if len(hosts) != 0 {
+			return fmt.Errorf("--netrc-host requires --netrc or --git-credentials")
+		}
+		return nil
+	}
+
+	var entries []secrets.NetrcEntry
+	for _, source := range []struct {
+		filename string
+		parse    func([]byte) ([]secrets.NetrcEntry, error)
+	}{
+		{netrcFile, secrets.ParseNetrc},
+		{gitCredentialsFile, secrets.ParseGitCredentials},
+	} {
+		if source.filename == "" {
+			continue
+		}
+
+		content, err := ioutil.ReadFile(source.filename)
+		if err != nil {
+			return err
+		}
+		parsed, err := source.parse(content)
+		secrets.Wipe(content)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %s", source.filename, err)
+		}
+		entries = append(entries, parsed...)
+	}
+
+	values, err := secrets.NetrcSecrets("netrc", entries, hosts)
+	if err != nil {
+		return err
+	}
+	for key, value := range values {
+		store.Set(key, value)
+		secrets.Wipe(value)
+	}
+	return nil
+}
+
+// loadSecretsFromDirs handles `--secrets-dir DIR`, adding every regular
+// file under each directory, keyed by its relative path.
+func loadSecretsFromDirs(store *secrets.Store, dirs []string) error {
+	for _, dir := range dirs {
+		values, err := secrets.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("reading %q: %s", dir, err)
+		}
+
+		for key, value := range values {
+			store.Set(key, value)
+			secrets.Wipe(value)
+		}
+	}
+	return nil
+}
+
+// watchFileSecrets reloads the `--secret-from-file` and `--secrets-dir`
+// secrets when they change on disk. The watcher is nil without any.
+func watchFileSecrets(store *secrets.Store, fileSpecs []string, dirs []string) (*secrets.FileWatcher, error) {
+	if len(fileSpecs) == 0 && len(dirs) == 0 {
+		return nil, nil
+	}
+
+	watcher, err := secrets.NewFileWatcher(store)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range fileSpecs {
+		spec, _, _ := parseSecretOptions(spec)
+		parts := strings.SplitN(spec, "=", 2)
+		filename := parts[len(parts)-1]
+		if err := watcher.AddFile(parts[0], filename); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watching %q: %s", filename, err)
+		}
+	}
+
+	for _, dir := range dirs {
+		if err := watcher.AddDir(dir); err != nil {
+			watcher.Close()
+			return nil, fmt.Errorf("watching %q: %s", dir, err)
+		}
+	}
+
+	log.Println("Watching file-backed secrets for changes")
+	return watcher, nil
+}
+
+// loadSecretsFromCommands handles `--secret-from-command key="cmd args"`.
+func loadSecretsFromCommands(specs []string) (*secrets.CommandProvider, error) {
+	commands := secrets.NewCommandProvider(secretCommandTimeout, secretCommandRefresh)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf(`invalid secret from command, expected format "key=command args", got %q`, spec)
+		}
+		commands.Add(parts[0], parts[1])
+	}
+
+	if !secretCommandLazy {
+		if err := commands.Prefetch(); err != nil {
+			return nil, err
+		}
+	}
+
+	return commands, nil
+}
+
+// newVaultProvider handles `--vault-addr` and friends.
+func newVaultProvider() (*secrets.VaultProvider, error) {
+	vault := secrets.NewVaultProvider(vaultAddr, vaultMount)
+	if vaultRoleID != "" {
+		vault.RoleID = vaultRoleID
+		vault.SecretID = os.Getenv(vaultSecretIDEnv)
+		if vault.SecretID == "" {
+			return nil, fmt.Errorf("--vault-role-id requires a secret ID in $%s", vaultSecretIDEnv)
+		}
+	} else {
+		vault.Token = os.Getenv("VAULT_TOKEN")
+		if vault.Token == "" {
+			return nil, fmt.Errorf("set VAULT_TOKEN, or use --vault-role-id")
+		}
+	}
+	return vault, nil
+}
+
+// newAWSProvider handles `--aws` and friends. Endpoints can also be set
+// per service, with `AWS_ENDPOINT_URL_SECRETS_MANAGER` and
+// `AWS_ENDPOINT_URL_SSM`.
+func newAWSProvider() (*secrets.AWSProvider, error) {
+	creds, region, err := secrets.LoadAWSConfig(awsProfile)
+	if err != nil {
+		return nil, err
+	}
+	if awsRegion != "" {
+		region = awsRegion
+	}
+	if region == "" {
+		return nil, fmt.Errorf("no AWS region configured, use --aws-region")
+	}
+
+	aws := secrets.NewAWSProvider(region, creds)
+	aws.SecretsManagerEndpoint = os.Getenv("AWS_ENDPOINT_URL_SECRETS_MANAGER")
+	if aws.SecretsManagerEndpoint == "" {
+		aws.SecretsManagerEndpoint = awsEndpointURL
+	}
+	aws.SSMEndpoint = os.Getenv("AWS_ENDPOINT_URL_SSM")
+	if aws.SSMEndpoint == "" {
+		aws.SSMEndpoint = awsEndpointURL
+	}
+	return aws, nil
+}
+
+// loadSecretsFromBundles handles `--secrets-bundle FILE`. All bundles
+// are expected to share the same passphrase.
+func loadSecretsFromBundles(store *secrets.Store, filenames []string) error {
+	if len(filenames) == 0 {
+		return nil
+	}
+
+	passphrase, err := readPassphrase("Bundle passphrase: ", false)
+	if err != nil {
+		return err
+	}
+
+	for _, filename := range filenames {
+		values, err := bundle.ReadFile(filename, passphrase)
+		if err != nil {
+			return fmt.Errorf("reading %q: %s", filename, err)
+		}
+		store.SetAll(values)
+		for _, value := range values {
+			secrets.Wipe(value)
+		}
+	}
+	return nil
+}
+
+var secretOptionRE = regexp.MustCompile(`;(max-reads|ttl)=([^;=]*)$`)
+
+// parseSecretOptions strips the `;max-reads=N` and `;ttl=DURATION`
+// options from the end of a `--secret` or `--secret-from-file` spec.
+func parseSecretOptions(spec string) (string, secrets.Limits, error) {
+	var limits secrets.Limits
+	for {
+		matches := secretOptionRE.FindStringSubmatchIndex(spec)
+		if matches == nil {
+			return spec, limits, nil
+		}
+
+		name := spec[matches[2]:matches[3]]
+		value := spec[matches[4]:matches[5]]
+		spec = spec[:matches[0]]
+
+		switch name {
+		case "max-reads":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return "", limits, fmt.Errorf("invalid max-reads %q, expected a positive number", value)
+			}
+			limits.MaxReads = n
+		case "ttl":
+			ttl, err := time.ParseDuration(value)
+			if err != nil || ttl <= 0 {
+				return "", limits, fmt.Errorf("invalid ttl %q, expected a duration like 60s", value)
+			}
+			limits.TTL = ttl
+		}
+	}
+}
+
+// loadSecretTemplates handles `--secret-template key=template-file`.
+// Templates get their values from `source`.
+func loadSecretTemplates(source secrets.Provider, specs []string) (*secrets.TemplateProvider, error) {
+	templates := secrets.NewTemplateProvider(source)
+	for _, spec := range specs {
+		parts := strings.SplitN(spec, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf(`invalid secret template, expected format "key=template-file", got %q`, spec)
+		}
+
+		content, err := ioutil.ReadFile(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if err := templates.Add(parts[0], string(content)); err != nil {
+			return nil, fmt.Errorf("parsing %q: %s", parts[1], err)
+		}
+	}
+	return templates, nil
+}
+
+// secretMeta is the user-facing form of `secrets.Metadata`, as given
+// by `--secret-meta` and in `--secrets-meta-file`.
+type secretMeta struct {
+	Description string `yaml:"description" mapstructure:"description"`
+	Filename    string `yaml:"filename" mapstructure:"filename"`
+	Mode        string `yaml:"mode" mapstructure:"mode"`
+	ContentType string `yaml:"content_type" mapstructure:"content_type"`
+	// Expires is an RFC3339 time, or a duration from now like `2h`.
+	Expires string `yaml:"expires" mapstructure:"expires"`
+}
+
+func (m secretMeta) toMetadata() (md secrets.Metadata, err error) {
+	md = secrets.Metadata{
+		Description: m.Description,
+		Filename:    m.Filename,
+		Mode:        m.Mode,
+		ContentType: m.ContentType,
+	}
+
+	if m.Expires != "" {
+		expires, err := time.Parse(time.RFC3339, m.Expires)
+		if err != nil {
+			ttl, durErr := time.ParseDuration(m.Expires)
+			if durErr != nil {
+				return md, fmt.Errorf("invalid expires %q, expected an RFC3339 time or a duration", m.Expires)
+			}
+			expires = time.Now().Add(ttl)
+		}
+		md.Expires = &expires
+	}
+
+	return md, md.Validate()
+}
+
+// parseSecretMeta handles `--secret-meta
+// "key;mode=0600;filename=id_rsa;content-type=text/plain;description=...;expires=2h"`.
+func parseSecretMeta(spec string) (string, secrets.Metadata, error) {
+	parts := strings.Split(spec, ";")
+	key := parts[0]
+	if key == "" {
+		return "", secrets.Metadata{}, fmt.Errorf("missing key in %q", spec)
+	}
+
+	var meta secretMeta
+	for _, part := range parts[1:] {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return "", secrets.Metadata{}, fmt.Errorf("expected name=value, got %q", part)
+		}
+		switch kv[0] {
+		case "description":
+			meta.Description = kv[1]
+		case "filename":
+			meta.Filename = kv[1]
+		case "mode":
+			meta.Mode = kv[1]
+		case "content-type":
+			meta.ContentType = kv[1]
+		case "expires":
+			meta.Expires = kv[1]
+		default:
+			return "", secrets.Metadata{}, fmt.Errorf("unknown metadata %q", kv[0])
+		}
+	}
+
+	md, err := meta.toMetadata()
+	return key, md, err
+}
+
+// loadSecretsMeta handles `--secret-meta` and `--secrets-meta-file`.
+func loadSecretsMeta(chain *secrets.Chain, specs []string, filenames []string) error {
+	for _, filename := range filenames {
+		content, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		var entries map[string]secretMeta
+		if err := yaml.Unmarshal(content, &entries); err != nil {
+			return fmt.Errorf("parsing %q: %s", filename, err)
+		}
+
+		for key, entry := range entries {
+			md, err := entry.toMetadata()
+			if err != nil {
+				return fmt.Errorf("%q, key %q: %s", filename, key, err)
+			}
+			chain.SetMetadata(key, md)
+		}
+	}
+
+	for _, spec := range specs {
+		key, md, err := parseSecretMeta(spec)
+		if err != nil {
+			return err
+		}
+		chain.SetMetadata(key, md)
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package acl maps client identities to the secrets and features they
+// can use on a bridge.
+package acl
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Permissions for bridge features, granted like secret keys.
+const (
+	// SSHAgent allows using the SSH-Agent forwarder.
+	SSHAgent = "@ssh-agent"
+	// Quit allows stopping the server.
+	Quit = "@quit"
+)
+
+// Policy lists the patterns each client identity is allowed. Patterns
+// are globs where `*` matches any characters, `/` included, and `?` a
+// single one, so `npm/*` allows a whole namespace, and `*` everything.
+//
+// An empty policy allows everything, to everyone. As soon as a rule is
+// added, identities without rules are denied everything.
+type Policy struct {
+	lock  sync.RWMutex
+	rules map[string][]rule
+}
+
+type rule struct {
+	pattern string
+	re      *regexp.Regexp
+}
+
+// New returns an empty policy.
+func New() *Policy {
+	return &Policy{}
+}
+
+// ParseRule reads a rule like `ci-frontend=npm/*,docker/*`.
+func ParseRule(spec string) (identity string, patterns []string, err error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", nil, fmt.Errorf(`invalid policy rule, expected format "identity=pattern,...", got %q`, spec)
+	}
+
+	for _, pattern := range strings.Split(parts[1], ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return "", nil, fmt.Errorf("no patterns in policy rule %q", spec)
+	}
+	return parts[0], patterns, nil
+}
+
+// Allow grants `patterns` to `identity`, on top of what it already has.
+func (p *Policy) Allow(identity string, patterns ...string) error {
+	var rules []rule
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return fmt.Errorf("empty pattern for %q", identity)
+		}
+		rules = append(rules, rule{pattern: pattern, re: globToRegexp(pattern)})
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.rules == nil {
+		p.rules = make(map[string][]rule)
+	}
+	p.rules[identity] = append(p.rules[identity], rules...)
+	return nil
+}
+
+// Enabled tells whether the policy has any rules.
+func (p *Policy) Enabled() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.rules) != 0
+}
+
+// Allowed tells whether `identity` can use `key`, a secret key or one of
+// the feature permissions.
+func (p *Policy) Allowed(identity, key string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if len(p.rules) == 0 {
+		return true
+	}
+	for _, rule := range p.rules[identity] {
+		if rule.re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// Has tells whether `identity` has rules.
+func (p *Policy) Has(identity string) bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	return len(p.rules[identity]) != 0
+}
+
+// Identities returns the identities having rules, sorted.
+func (p *Policy) Identities() []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	var out []string
+	for identity := range p.rules {
+		out = append(out, identity)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// MatchAny tells whether `key` matches any of `patterns`, with the same
+// syntax as policies.
+func MatchAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if globToRegexp(pattern).MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func globToRegexp(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			expr.WriteString(".*")
+		case '?':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
@@ -0,0 +1,65 @@
+package acl
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmptyPolicyAllowsAll(t *testing.T) {
+	p := New()
+	assert.False(t, p.Enabled())
+	assert.True(t, p.Allowed("anyone", "npm/token"))
+	assert.True(t, p.Allowed("", Quit))
+}
+
+func TestPolicy(t *testing.T) {
+	p := New()
+	assert.NoError(t, p.Allow("ci-frontend", "npm/*", "id_rsa"))
+	assert.NoError(t, p.Allow("ci-frontend", SSHAgent))
+	assert.NoError(t, p.Allow("ops", "*"))
+	assert.True(t, p.Enabled())
+
+	assert.True(t, p.Allowed("ci-frontend", "npm/token"))
+	assert.True(t, p.Allowed("ci-frontend", "npm/sub/token"))
+	assert.True(t, p.Allowed("ci-frontend", "id_rsa"))
+	assert.True(t, p.Allowed("ci-frontend", SSHAgent))
+	assert.False(t, p.Allowed("ci-frontend", "id_rsa.pub"))
+	assert.False(t, p.Allowed("ci-frontend", "npmrc"))
+	assert.False(t, p.Allowed("ci-frontend", Quit))
+
+	assert.True(t, p.Allowed("ops", Quit))
+	assert.True(t, p.Allowed("ops", "vault:secret/ci#token"))
+
+	assert.False(t, p.Allowed("unknown", "npm/token"))
+	assert.False(t, p.Allowed("", "npm/token"))
+
+	assert.Equal(t, []string{"ci-frontend", "ops"}, p.Identities())
+	assert.True(t, p.Has("ops"))
+	assert.False(t, p.Has("unknown"))
+}
+
+func TestMatchAny(t *testing.T) {
+	assert.True(t, MatchAny([]string{"docker/*", "npm/*"}, "npm/token"))
+	assert.False(t, MatchAny([]string{"docker/*", "npm/*"}, "id_rsa"))
+	assert.False(t, MatchAny(nil, "npm/token"))
+}
+
+func TestGlobQuoting(t *testing.T) {
+	p := New()
+	assert.NoError(t, p.Allow("a", "aws-sm:ci.token?"))
+	assert.True(t, p.Allowed("a", "aws-sm:ci.token1"))
+	assert.False(t, p.Allowed("a", "aws-sm:cixtoken1"))
+}
+
+func TestParseRule(t *testing.T) {
+	identity, patterns, err := ParseRule("ci-frontend=npm/*, docker/*,")
+	assert.NoError(t, err)
+	assert.Equal(t, "ci-frontend", identity)
+	assert.Equal(t, []string{"npm/*", "docker/*"}, patterns)
+
+	for _, spec := range []string{"ci-frontend", "=npm/*", "ci-frontend=", "ci-frontend= , "} {
+		_, _, err := ParseRule(spec)
+		assert.Error(t, err, spec)
+	}
+}
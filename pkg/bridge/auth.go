@@ -14,6 +14,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+)
+
+// Common names of the client certs issued by the bridge.
+const (
+	ClientCommonName = "secrets-bridge"
+	AdminCommonName  = "secrets-bridge-admin"
 )
 
 type Bridge struct {
@@ -28,6 +35,9 @@ type Bridge struct {
 	ClientKey     string `json:"client_key"`
 	clientTLSCert tls.Certificate
 
+	certLifetime time.Duration
+	clients      *Clients
+
 	Listener net.Listener `json:"-"`
 }
 
@@ -42,6 +52,15 @@ func NewFromDefaultConfig() (bridge *Bridge, err error) {
 	return NewFromString(string(cnt))
 }
 
+func NewFromFile(filename string) (bridge *Bridge, err error) {
+	cnt, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read %q", filename)
+	}
+
+	return NewFromString(string(cnt))
+}
+
 func NewFromString(conf string) (bridge *Bridge, err error) {
 	content := []byte(strings.TrimSpace(conf))
 
@@ -82,6 +101,23 @@ func NewFromString(conf string) (bridge *Bridge, err error) {
 	return
 }
 
+// Encode returns the bridge conf in the compact form read by
+// `NewFromString`: gzipped JSON, base64-url-encoded.
+func (b *Bridge) Encode() (string, error) {
+	jsonConfig, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+
+	buf := &bytes.Buffer{}
+
+	gz, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+	gz.Write(jsonConfig)
+	gz.Close()
+
+	return base64.RawURLEncoding.EncodeToString(buf.Bytes()), nil
+}
+
 func (b *Bridge) readCACertPool() (*x509.CertPool, error) {
 	caCertPool := x509.NewCertPool()
 
@@ -117,6 +153,17 @@ func (b *Bridge) ServerTLSConfig(insecure bool) *tls.Config {
 		Certificates: []tls.Certificate{b.caTLSCert}, // populated through `NewBridge`
 		ClientCAs:    b.caCertPool,
 		ClientAuth:   tls.RequireAndVerifyClientCert,
+		// Resumed sessions skip `VerifyPeerCertificate`, and would let
+		// revoked certs back in.
+		SessionTicketsDisabled: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+			for _, chain := range verifiedChains {
+				if b.IsRevoked(chain[0]) {
+					return fmt.Errorf("client cert %s was revoked", chain[0].SerialNumber)
+				}
+			}
+			return nil
+		},
 	}
 	if insecure {
 		c.ClientAuth = tls.VerifyClientCertIfGiven
@@ -124,3 +171,50 @@ func (b *Bridge) ServerTLSConfig(insecure bool) *tls.Config {
 	c.BuildNameToCertificate()
 	return c
 }
+
+// Clients returns the client certs issued by the bridge. It is nil for
+// bridge confs read by clients.
+func (b *Bridge) Clients() *Clients {
+	return b.clients
+}
+
+// IsRevoked tells whether `cert` was revoked with `Clients`.
+func (b *Bridge) IsRevoked(cert *x509.Certificate) bool {
+	return b.clients != nil && b.clients.IsRevoked(cert.SerialNumber)
+}
+
+// IsAdmin tells whether the verified client cert of `state` is an admin
+// cert, issued by `NewAdminBridge`.
+func IsAdmin(state *tls.ConnectionState) bool {
+	return ClientIdentity(state) == AdminCommonName
+}
+
+// ClientScopes returns the key patterns the verified client cert of
+// `state` is limited to, and whether it is limited at all. Certs issued
+// by `NewClientBridge` with scopes are.
+func ClientScopes(state *tls.ConnectionState) ([]string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return nil, false
+	}
+	scopes := state.VerifiedChains[0][0].Subject.OrganizationalUnit
+	return scopes, len(scopes) != 0
+}
+
+// ClientSerial returns the serial number of the verified client cert of
+// `state`, in decimal, or an empty string.
+func ClientSerial(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].SerialNumber.String()
+}
+
+// ClientIdentity returns the common name of the verified client cert of
+// `state`, like `ClientCommonName` for the cert of `NewBridge`. It is
+// empty when no cert was verified, with `--insecure`.
+func ClientIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
@@ -12,11 +12,48 @@ import (
 	"log"
 	"math/big"
 	"net"
+	"os"
 	"strings"
 	"time"
 )
 
-func NewCachedBridge(caKeyStore, confFile string) (bridge *Bridge, err error) {
+// Options tune the bridge created by `NewBridge` and `NewCachedBridge`.
+type Options struct {
+	// Listen is the `host:port` to listen on. An empty host listens on
+	// all interfaces, and advertises all their IPs. Defaults to a random
+	// port on all interfaces.
+	Listen string
+	// CertLifetime is how long the CA and client certs are valid.
+	// Defaults to `DefaultCertLifetime`.
+	CertLifetime time.Duration
+}
+
+// DefaultCertLifetime is the validity of the certs when
+// `Options.CertLifetime` isn't set.
+const DefaultCertLifetime = 1 * time.Hour
+
+func (o Options) listenHostPort() (host, port string, err error) {
+	if o.Listen == "" {
+		return "", "0", nil
+	}
+	host, port, err = net.SplitHostPort(o.Listen)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid listen address %q: %s", o.Listen, err)
+	}
+	if port == "" {
+		port = "0"
+	}
+	return host, port, nil
+}
+
+func (o Options) certLifetime() time.Duration {
+	if o.CertLifetime == 0 {
+		return DefaultCertLifetime
+	}
+	return o.CertLifetime
+}
+
+func NewCachedBridge(caKeyStore, confFile string, opts Options) (bridge *Bridge, err error) {
 	bridgeConf, err := ioutil.ReadFile(confFile)
 	if err != nil {
 		return nil, err
@@ -35,7 +72,13 @@ func NewCachedBridge(caKeyStore, confFile string) (bridge *Bridge, err error) {
 	segments := strings.Split(firstEndpoint, ":")
 	listenPort := segments[len(segments)-1]
 
-	listener, err := net.Listen("tcp", ":"+listenPort)
+	// The port must stay the same, for the bridge conf to stay valid.
+	listenHost, _, err := opts.listenHostPort()
+	if err != nil {
+		return
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(listenHost, listenPort))
 	if err != nil {
 		return
 	}
@@ -51,31 +94,70 @@ func NewCachedBridge(caKeyStore, confFile string) (bridge *Bridge, err error) {
 	if err != nil {
 		return
 	}
+	bridge.certLifetime = opts.certLifetime()
+
+	bridge.clients = newClients()
+	if err = bridge.clients.loadRevoked(revokedFilename(caKeyStore)); err != nil {
+		return
+	}
+	clientCert, err := bridge.ClientCertificate()
+	if err != nil {
+		return
+	}
+	if bridge.clients.IsRevoked(clientCert.SerialNumber) {
+		bridge.Listener.Close()
+		return nil, fmt.Errorf("the client cert of the cached bridge conf, serial %s, was revoked", clientCert.SerialNumber)
+	}
+	bridge.clients.add(clientCert)
 
 	return
 }
 
 // NewBridge generates all that is needed to serve a bridge. It generates crypto material (ca cert+key and client cert+key), creates the listener, lists the available IPs.
-func NewBridge(caKeyStore string) (bridge *Bridge, err error) {
-	bridge = &Bridge{}
+func NewBridge(caKeyStore string, opts Options) (bridge *Bridge, err error) {
+	bridge = &Bridge{
+		certLifetime: opts.certLifetime(),
+		clients:      newClients(),
+	}
+
+	listenHost, listenPort, err := opts.listenHostPort()
+	if err != nil {
+		return
+	}
 
 	ips, err := GetAllIPs()
 	if err != nil {
 		return
 	}
 
-	listener, err := net.Listen("tcp", ":0")
+	listener, err := net.Listen("tcp", net.JoinHostPort(listenHost, listenPort))
 	if err != nil {
 		return
 	}
 
 	bridge.Listener = listener
-	for _, ip := range ips {
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	// A specific host is the only endpoint, and must be in the server
+	// cert, be it an IP or a name.
+	var dnsNames []string
+	advertised := ips
+	if listenHost != "" {
+		if ip := net.ParseIP(listenHost); ip == nil {
+			dnsNames = []string{listenHost}
+			advertised = nil
+			bridge.Endpoints = []string{fmt.Sprintf("https://%s", net.JoinHostPort(listenHost, fmt.Sprint(port)))}
+		} else if !ip.IsUnspecified() {
+			advertised = []net.IP{ip}
+		}
+	}
+
+	for _, ip := range advertised {
 		ipStr := ip.String()
 		if strings.Contains(ipStr, ":") {
 			ipStr = "[" + ipStr + "]"
 		}
-		bridge.Endpoints = append(bridge.Endpoints, fmt.Sprintf("https://%s:%d", ipStr, listener.Addr().(*net.TCPAddr).Port))
+		bridge.Endpoints = append(bridge.Endpoints, fmt.Sprintf("https://%s:%d", ipStr, port))
 	}
 
 	// Generate CA key+cert
@@ -92,13 +174,14 @@ func NewBridge(caKeyStore string) (bridge *Bridge, err error) {
 		},
 		SignatureAlgorithm:    x509.SHA256WithRSA,
 		NotBefore:             time.Now(),
-		NotAfter:              time.Now().Add(1 * time.Hour),
+		NotAfter:              time.Now().Add(bridge.certLifetime),
 		BasicConstraintsValid: true,
 		IsCA:           true,
 		MaxPathLenZero: true,
 		KeyUsage:       x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
 		ExtKeyUsage:    []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
 		IPAddresses:    ips,
+		DNSNames:       dnsNames,
 	}
 
 	derBytes, err := x509.CreateCertificate(rand.Reader, caCertTpl, caCertTpl, &privKey.PublicKey, privKey)
@@ -126,6 +209,12 @@ func NewBridge(caKeyStore string) (bridge *Bridge, err error) {
 		if err = ioutil.WriteFile(caKeyStore, []byte(caKey), 0600); err != nil {
 			return
 		}
+		// The revocations of the previous CA don't apply to this one.
+		revokedFile := revokedFilename(caKeyStore)
+		if err = os.Remove(revokedFile); err != nil && !os.IsNotExist(err) {
+			return
+		}
+		bridge.clients.revokedFile = revokedFile
 	}
 
 	bridge.caTLSCert, err = tls.X509KeyPair([]byte(bridge.CACert), caKey)
@@ -134,14 +223,106 @@ func NewBridge(caKeyStore string) (bridge *Bridge, err error) {
 	}
 
 	// Generate client key + csr + cert
+	serial, err := randomSerial()
+	if err != nil {
+		return
+	}
+	bridge.ClientCert, bridge.ClientKey, err = bridge.issueClientCert(ClientCommonName, nil, serial, bridge.certLifetime)
+	if err != nil {
+		return
+	}
+
+	return
+}
+
+// NewAdminBridge returns a copy of the bridge config holding a freshly
+// issued admin client cert, allowed to modify secrets at runtime. It
+// must be kept apart from the regular bridge conf.
+func (b *Bridge) NewAdminBridge() (*Bridge, error) {
+	return b.newClientBridge(AdminCommonName, nil, b.certLifetime)
+}
+
+// NewClientBridge returns a copy of the bridge config holding a freshly
+// issued client cert for `name`, with its own key and serial. If
+// `scopes` are given, the cert carries them, and the server only lets it
+// use matching keys. `ttl` can't outlive the CA, and defaults to the
+// CA's remaining lifetime.
+func (b *Bridge) NewClientBridge(name string, scopes []string, ttl time.Duration) (*Bridge, error) {
+	if name == "" || name == AdminCommonName {
+		return nil, fmt.Errorf("invalid client name %q", name)
+	}
+
+	caCert, err := x509.ParseCertificate(b.caTLSCert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if ttl == 0 {
+		ttl = time.Until(caCert.NotAfter)
+	} else if time.Now().Add(ttl).After(caCert.NotAfter) {
+		return nil, fmt.Errorf("ttl %s outlives the CA, which expires at %s", ttl, caCert.NotAfter.Format(time.RFC3339))
+	}
+
+	return b.newClientBridge(name, scopes, ttl)
+}
+
+func (b *Bridge) newClientBridge(commonName string, scopes []string, ttl time.Duration) (*Bridge, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &Bridge{
+		Endpoints:  b.Endpoints,
+		CACert:     b.CACert,
+		caCertPool: b.caCertPool,
+	}
+
+	client.ClientCert, client.ClientKey, err = b.issueClientCert(commonName, scopes, serial, ttl)
+	if err != nil {
+		return nil, err
+	}
+
+	client.clientTLSCert, err = tls.X509KeyPair([]byte(client.ClientCert), []byte(client.ClientKey))
+	if err != nil {
+		return nil, err
+	}
+
+	return client, nil
+}
+
+// randomSerial returns a serial for a client cert, random so that
+// revoking one never hits the certs of other bridge confs.
+func randomSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 62))
+}
+
+// ClientCertificate returns the parsed client cert of the bridge conf.
+func (b *Bridge) ClientCertificate() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(b.ClientCert))
+	if block == nil {
+		return nil, fmt.Errorf("no client cert in bridge conf")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// issueClientCert generates a client key and a cert signed by the CA,
+// and returns them PEM-encoded. `scopes` go in the organizational units
+// of the subject, like Kubernetes puts groups in its organizations.
+func (b *Bridge) issueClientCert(commonName string, scopes []string, serial *big.Int, ttl time.Duration) (certPEM, keyPEM string, err error) {
+	caCert, err := x509.ParseCertificate(b.caTLSCert.Certificate[0])
+	if err != nil {
+		return
+	}
+
 	clientCertTpl := &x509.Certificate{
-		SerialNumber: big.NewInt(2),
+		SerialNumber: serial,
 		Subject: pkix.Name{
-			Organization: []string{"secrets-bridge"},
-			CommonName:   "secrets-bridge",
+			Organization:       []string{"secrets-bridge"},
+			OrganizationalUnit: scopes,
+			CommonName:         commonName,
 		},
 		NotBefore:   time.Now(),
-		NotAfter:    time.Now().Add(1 * time.Hour),
+		NotAfter:    time.Now().Add(ttl),
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
 		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
 	}
@@ -150,21 +331,25 @@ func NewBridge(caKeyStore string) (bridge *Bridge, err error) {
 		return
 	}
 
-	clientCert, err := x509.CreateCertificate(rand.Reader, clientCertTpl, caCertTpl, &clientPriv.PublicKey, privKey)
+	clientCert, err := x509.CreateCertificate(rand.Reader, clientCertTpl, caCert, &clientPriv.PublicKey, b.caTLSCert.PrivateKey)
 	if err != nil {
 		return
 	}
 
-	bridge.ClientCert = string(pem.EncodeToMemory(&pem.Block{
+	if b.clients != nil {
+		issued, err := x509.ParseCertificate(clientCert)
+		if err != nil {
+			return "", "", err
+		}
+		b.clients.add(issued)
+	}
+
+	certPEM = string(pem.EncodeToMemory(&pem.Block{
 		Type:  "CERTIFICATE",
 		Bytes: clientCert,
 	}))
 
-	// if ok := bridge.caCertPool.AppendCertsFromPEM([]byte(bridge.ClientCert)); !ok {
-	// 	return nil, fmt.Errorf("oh mama")
-	// }
-
-	bridge.ClientKey = string(pem.EncodeToMemory(&pem.Block{
+	keyPEM = string(pem.EncodeToMemory(&pem.Block{
 		Type:  "RSA PRIVATE KEY",
 		Bytes: x509.MarshalPKCS1PrivateKey(clientPriv),
 	}))
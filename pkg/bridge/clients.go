@@ -0,0 +1,204 @@
+package bridge
+
+import (
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IssuedClient is a client cert issued by the bridge.
+type IssuedClient struct {
+	Serial   string    `json:"serial"`
+	Name     string    `json:"name"`
+	Scopes   []string  `json:"scopes,omitempty"`
+	NotAfter time.Time `json:"not_after"`
+	Revoked  bool      `json:"revoked"`
+}
+
+// Clients tracks the client certs issued by a bridge, and those revoked.
+// The revoked serials are kept in a file next to the CA key store, so
+// they stay revoked when the CA is reused. The issued certs only live in
+// memory: those issued before a restart with `--ca-key-store` can still
+// be revoked by serial, but not by name.
+type Clients struct {
+	lock        sync.RWMutex
+	issued      map[string]*IssuedClient
+	revoked     map[string]bool
+	revokedFile string
+}
+
+func newClients() *Clients {
+	return &Clients{
+		issued:  make(map[string]*IssuedClient),
+		revoked: make(map[string]bool),
+	}
+}
+
+// revokedFilename is where the revoked serials of the CA in
+// `caKeyStore` are kept.
+func revokedFilename(caKeyStore string) string {
+	return caKeyStore + ".revoked"
+}
+
+// loadRevoked reads the revoked serials from `filename`, one per line,
+// and appends those revoked later to it. A missing file has none.
+func (c *Clients) loadRevoked(filename string) error {
+	c.revokedFile = filename
+
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		n, ok := new(big.Int).SetString(line, 10)
+		if !ok {
+			return fmt.Errorf("invalid serial %q in %q", line, filename)
+		}
+		c.revoked[n.String()] = true
+	}
+	return nil
+}
+
+// persistRevoked appends `serials` to the revoked file, if any. It's
+// called before they're marked revoked, so the file never misses one
+// that's refused in memory.
+func (c *Clients) persistRevoked(serials []string) error {
+	if c.revokedFile == "" || len(serials) == 0 {
+		return nil
+	}
+
+	f, err := os.OpenFile(c.revokedFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("recording revocation: %s", err)
+	}
+	_, err = f.WriteString(strings.Join(serials, "\n") + "\n")
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("recording revocation: %s", err)
+	}
+	return nil
+}
+
+func (c *Clients) add(cert *x509.Certificate) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	serial := cert.SerialNumber.String()
+	c.issued[serial] = &IssuedClient{
+		Serial:   serial,
+		Name:     cert.Subject.CommonName,
+		Scopes:   cert.Subject.OrganizationalUnit,
+		NotAfter: cert.NotAfter,
+		Revoked:  c.revoked[serial],
+	}
+}
+
+// List returns the issued clients, sorted by name.
+func (c *Clients) List() []IssuedClient {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	out := []IssuedClient{}
+	for _, client := range c.issued {
+		out = append(out, *client)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Name != out[j].Name {
+			return out[i].Name < out[j].Name
+		}
+		return out[i].Serial < out[j].Serial
+	})
+	return out
+}
+
+// RevokeSerial revokes the cert with `serial`, a decimal number. The
+// admin cert can't be revoked, to keep control of the bridge.
+func (c *Clients) RevokeSerial(serial string) (IssuedClient, error) {
+	n, ok := new(big.Int).SetString(serial, 10)
+	if !ok {
+		return IssuedClient{}, fmt.Errorf("invalid serial %q, expected a decimal number", serial)
+	}
+	serial = n.String()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	client := c.issued[serial]
+	if client == nil {
+		// Issued before a restart, most likely.
+		client = &IssuedClient{Serial: serial}
+	}
+	if client.Name == AdminCommonName {
+		return IssuedClient{}, fmt.Errorf("the admin client cert can't be revoked")
+	}
+
+	if !c.revoked[serial] {
+		if err := c.persistRevoked([]string{serial}); err != nil {
+			return IssuedClient{}, err
+		}
+	}
+	client.Revoked = true
+	c.revoked[serial] = true
+	return *client, nil
+}
+
+// RevokeName revokes all the certs issued to `name`.
+func (c *Clients) RevokeName(name string) ([]IssuedClient, error) {
+	if name == AdminCommonName {
+		return nil, fmt.Errorf("the admin client cert can't be revoked")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var matched []*IssuedClient
+	var serials []string
+	for serial, client := range c.issued {
+		if client.Name != name {
+			continue
+		}
+		matched = append(matched, client)
+		if !c.revoked[serial] {
+			serials = append(serials, serial)
+		}
+	}
+	if len(matched) == 0 {
+		return nil, fmt.Errorf("no client cert issued to %q", name)
+	}
+	sort.Strings(serials)
+	if err := c.persistRevoked(serials); err != nil {
+		return nil, err
+	}
+
+	var out []IssuedClient
+	for _, client := range matched {
+		client.Revoked = true
+		c.revoked[client.Serial] = true
+		out = append(out, *client)
+	}
+	return out, nil
+}
+
+// IsRevoked tells whether the cert with `serial` was revoked.
+func (c *Clients) IsRevoked(serial *big.Int) bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	return c.revoked[serial.String()]
+}
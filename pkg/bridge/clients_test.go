@@ -0,0 +1,140 @@
+package bridge
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIssueAndRevokeClients(t *testing.T) {
+	b, err := NewBridge("", Options{Listen: "127.0.0.1:0", CertLifetime: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Listener.Close()
+	assert.Equal(t, 1, len(b.Endpoints))
+
+	frontend, err := b.NewClientBridge("ci-frontend", []string{"npm/*"}, 5*time.Minute)
+	assert.NoError(t, err)
+	admin, err := b.NewAdminBridge()
+	assert.NoError(t, err)
+
+	_, err = b.NewClientBridge("ci-frontend", nil, time.Hour)
+	assert.Error(t, err, "outlives the CA")
+	_, err = b.NewClientBridge(AdminCommonName, nil, 0)
+	assert.Error(t, err)
+
+	frontendCert, err := frontend.ClientCertificate()
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "ci-frontend", frontendCert.Subject.CommonName)
+	assert.Equal(t, []string{"npm/*"}, frontendCert.Subject.OrganizationalUnit)
+
+	var names []string
+	for _, issued := range b.Clients().List() {
+		names = append(names, issued.Name)
+	}
+	assert.Equal(t, []string{"ci-frontend", ClientCommonName, AdminCommonName}, names)
+
+	verify := b.ServerTLSConfig(false).VerifyPeerCertificate
+	assert.NoError(t, verify(nil, [][]*x509.Certificate{{frontendCert}}))
+
+	revoked, err := b.Clients().RevokeName("ci-frontend")
+	assert.NoError(t, err)
+	assert.Len(t, revoked, 1)
+	assert.True(t, b.IsRevoked(frontendCert))
+	assert.Error(t, verify(nil, [][]*x509.Certificate{{frontendCert}}))
+
+	_, err = b.Clients().RevokeName("unknown")
+	assert.Error(t, err)
+
+	adminCert, err := admin.ClientCertificate()
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = b.Clients().RevokeSerial(adminCert.SerialNumber.String())
+	assert.Error(t, err)
+	assert.False(t, b.IsRevoked(adminCert))
+
+	_, err = b.Clients().RevokeSerial("2")
+	assert.NoError(t, err)
+	_, err = b.Clients().RevokeSerial("0x2")
+	assert.Error(t, err)
+}
+
+func TestRevocationsSurviveRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-bridge")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caKeyStore := filepath.Join(dir, "ca.key")
+	confFile := filepath.Join(dir, "bridge-conf")
+
+	b, err := NewBridge(caKeyStore, Options{Listen: "127.0.0.1:0", CertLifetime: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf, err := b.Encode()
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(confFile, []byte(conf), 0600))
+
+	other, err := NewBridge("", Options{Listen: "127.0.0.1:0", CertLifetime: 10 * time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Listener.Close()
+	defaultCert, err := b.ClientCertificate()
+	assert.NoError(t, err)
+	otherCert, err := other.ClientCertificate()
+	assert.NoError(t, err)
+	assert.NotEqual(t, defaultCert.SerialNumber, otherCert.SerialNumber, "default client serials are random")
+
+	leaked, err := b.NewClientBridge("ci-frontend", nil, 0)
+	assert.NoError(t, err)
+	leakedCert, err := leaked.ClientCertificate()
+	assert.NoError(t, err)
+	_, err = b.Clients().RevokeName("ci-frontend")
+	assert.NoError(t, err)
+	_, err = b.Clients().RevokeSerial(leakedCert.SerialNumber.String())
+	assert.NoError(t, err, "revoking again")
+	b.Listener.Close()
+
+	restarted, err := NewCachedBridge(caKeyStore, confFile, Options{Listen: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.True(t, restarted.IsRevoked(leakedCert))
+	assert.False(t, restarted.IsRevoked(defaultCert))
+	verify := restarted.ServerTLSConfig(false).VerifyPeerCertificate
+	assert.Error(t, verify(nil, [][]*x509.Certificate{{leakedCert}}))
+
+	_, err = restarted.Clients().RevokeSerial(defaultCert.SerialNumber.String())
+	assert.NoError(t, err)
+	restarted.Listener.Close()
+
+	content, err := ioutil.ReadFile(caKeyStore + ".revoked")
+	assert.NoError(t, err)
+	assert.Equal(t, leakedCert.SerialNumber.String()+"\n"+defaultCert.SerialNumber.String()+"\n", string(content))
+
+	// The cached conf can't be served once its own cert is revoked.
+	_, err = NewCachedBridge(caKeyStore, confFile, Options{Listen: "127.0.0.1:0"})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "was revoked")
+	}
+
+	// A new CA starts with no revocations.
+	fresh, err := NewBridge(caKeyStore, Options{Listen: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh.Listener.Close()
+	_, err = os.Stat(caKeyStore + ".revoked")
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,156 @@
+// Package bundle reads and writes passphrase-encrypted files of secrets,
+// meant to be committed alongside the code that needs them.
+package bundle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	// Version is the current file format version.
+	Version = 1
+
+	kdfPBKDF2SHA256 = "pbkdf2-sha256"
+	cipherAES256GCM = "aes-256-gcm"
+
+	// DefaultIterations follows the OWASP recommendation for
+	// PBKDF2-HMAC-SHA256.
+	DefaultIterations = 600000
+
+	saltSize = 16
+	keySize  = 32
+)
+
+// file is the on-disk format. The KDF parameters are authenticated as
+// additional data, along with the version.
+type file struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Encrypt seals `secrets` with a key derived from `passphrase`.
+func Encrypt(secrets map[string][]byte, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+
+	f := &file{
+		Version:    Version,
+		KDF:        kdfPBKDF2SHA256,
+		Iterations: DefaultIterations,
+		Salt:       make([]byte, saltSize),
+		Cipher:     cipherAES256GCM,
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return nil, err
+	}
+
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return nil, err
+	}
+
+	plaintext, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plaintext, f.additionalData())
+
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Decrypt opens a bundle sealed by `Encrypt`.
+func Decrypt(content []byte, passphrase []byte) (map[string][]byte, error) {
+	f := &file{}
+	if err := json.Unmarshal(content, f); err != nil {
+		return nil, fmt.Errorf("invalid bundle format: %s", err)
+	}
+
+	if f.Version != Version {
+		return nil, fmt.Errorf("unsupported bundle version %d", f.Version)
+	}
+	if f.KDF != kdfPBKDF2SHA256 || f.Cipher != cipherAES256GCM {
+		return nil, fmt.Errorf("unsupported bundle kdf %q or cipher %q", f.KDF, f.Cipher)
+	}
+
+	aead, err := f.aead(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size")
+	}
+
+	plaintext, err := aead.Open(nil, f.Nonce, f.Ciphertext, f.additionalData())
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted bundle")
+	}
+
+	var secrets map[string][]byte
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return nil, fmt.Errorf("invalid bundle content: %s", err)
+	}
+
+	return secrets, nil
+}
+
+func ReadFile(filename string, passphrase []byte) (map[string][]byte, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return Decrypt(content, passphrase)
+}
+
+// WriteFile encrypts `secrets` to `filename`, replacing it atomically.
+func WriteFile(filename string, secrets map[string][]byte, passphrase []byte) error {
+	content, err := Encrypt(secrets, passphrase)
+	if err != nil {
+		return err
+	}
+
+	tmpFile := filename + ".tmp"
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, filename)
+}
+
+func (f *file) aead(passphrase []byte) (cipher.AEAD, error) {
+	if f.Iterations < 1 || len(f.Salt) < saltSize {
+		return nil, fmt.Errorf("invalid kdf parameters")
+	}
+
+	key := pbkdf2.Key(passphrase, f.Salt, f.Iterations, keySize, sha256.New)
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (f *file) additionalData() []byte {
+	return []byte(fmt.Sprintf("secrets-bridge-bundle v%d %s %d %x %s", f.Version, f.KDF, f.Iterations, f.Salt, f.Cipher))
+}
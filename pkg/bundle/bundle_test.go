@@ -0,0 +1,80 @@
+package bundle
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	secrets := map[string][]byte{
+		"npm_token": []byte("hello"),
+		"binary":    {0, 1, 2, 255},
+	}
+
+	content, err := Encrypt(secrets, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "hello")
+
+	decrypted, err := Decrypt(content, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Equal(t, secrets, decrypted)
+
+	_, err = Decrypt(content, []byte("wrong"))
+	assert.Error(t, err)
+}
+
+func TestTamperedCiphertext(t *testing.T) {
+	content, err := Encrypt(map[string][]byte{"key": []byte("value")}, []byte("passphrase"))
+	assert.NoError(t, err)
+
+	f := &file{}
+	assert.NoError(t, json.Unmarshal(content, f))
+	f.Ciphertext[0] ^= 0xff
+	tampered, _ := json.Marshal(f)
+	_, err = Decrypt(tampered, []byte("passphrase"))
+	assert.Error(t, err)
+
+	f.Ciphertext[0] ^= 0xff
+	f.Version = 2
+	tampered, _ = json.Marshal(f)
+	_, err = Decrypt(tampered, []byte("passphrase"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unsupported bundle version")
+	}
+}
+
+func TestTamperedParameters(t *testing.T) {
+	content, err := Encrypt(map[string][]byte{"key": []byte("value")}, []byte("passphrase"))
+	assert.NoError(t, err)
+
+	f := &file{}
+	assert.NoError(t, json.Unmarshal(content, f))
+
+	iterations := *f
+	iterations.Iterations++
+	tampered, _ := json.Marshal(iterations)
+	_, err = Decrypt(tampered, []byte("passphrase"))
+	assert.Error(t, err)
+
+	salt := *f
+	salt.Salt = append([]byte{}, f.Salt...)
+	salt.Salt[0] ^= 0xff
+	tampered, _ = json.Marshal(salt)
+	_, err = Decrypt(tampered, []byte("passphrase"))
+	assert.Error(t, err)
+
+	// Changed parameters also change the derived key, so open with the
+	// original key to show they are authenticated on their own.
+	aead, err := f.aead([]byte("passphrase"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = aead.Open(nil, f.Nonce, f.Ciphertext, f.additionalData())
+	assert.NoError(t, err)
+	_, err = aead.Open(nil, f.Nonce, f.Ciphertext, iterations.additionalData())
+	assert.Error(t, err)
+	_, err = aead.Open(nil, f.Nonce, f.Ciphertext, salt.additionalData())
+	assert.Error(t, err)
+}
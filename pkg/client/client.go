@@ -1,16 +1,21 @@
 package client
 
 import (
+	"bytes"
 	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/abourget/secrets-bridge/pkg/bridge"
+	"github.com/abourget/secrets-bridge/pkg/secrets"
 )
 
 func NewClient(conf *bridge.Bridge) *Client {
@@ -56,9 +61,126 @@ func (c *Client) Ping() error {
 }
 
 func (c *Client) GetSecret(key string) ([]byte, error) {
-	return c.doRequest("GET", fmt.Sprintf("/secrets/%s", key))
+	return c.doRequest("GET", "/secrets/"+escapeKey(key))
 }
 
+// GetSecretMeta returns the metadata of a secret, without its value.
+func (c *Client) GetSecretMeta(key string) (*secrets.Metadata, error) {
+	resp, err := c.doRequest("GET", "/secrets-meta/"+escapeKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	md := &secrets.Metadata{}
+	if err := json.Unmarshal(resp, md); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %s", err)
+	}
+	return md, nil
+}
+
+// ListSecrets returns the names and sizes of the secrets in the
+// namespace `prefix`, like `npm` or `npm/`. An empty `prefix` lists
+// everything. Values are never returned.
+func (c *Client) ListSecrets(prefix string) ([]secrets.KeyInfo, error) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	resp, err := c.doRequest("GET", "/secrets/"+escapeKey(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	var list []secrets.KeyInfo
+	if err := json.Unmarshal(resp, &list); err != nil {
+		return nil, fmt.Errorf("invalid listing: %s", err)
+	}
+	return list, nil
+}
+
+// PutSecret sets a secret on the bridge. It requires an admin bridge
+// conf, and a bridge served with `--admin-api`.
+func (c *Client) PutSecret(key string, value []byte) error {
+	_, err := c.doRequestWithBody("PUT", "/secrets/"+escapeKey(key), bytes.NewReader(value))
+	return err
+}
+
+// DeleteSecret removes a secret previously loaded in the bridge. It
+// requires an admin bridge conf, and a bridge served with `--admin-api`.
+func (c *Client) DeleteSecret(key string) error {
+	_, err := c.doRequest("DELETE", "/secrets/"+escapeKey(key))
+	return err
+}
+
+// IssueRequest asks the bridge for a new client cert. `TTL` is a
+// duration like `10m`, defaulting to the remaining lifetime of the
+// server's CA.
+type IssueRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes,omitempty"`
+	TTL    string   `json:"ttl,omitempty"`
+}
+
+// IssueClient gets a new bridge conf, with its own client cert, from
+// the bridge. It requires an admin bridge conf, and a bridge served with
+// `--admin-api`.
+func (c *Client) IssueClient(req IssueRequest) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := c.doRequestWithBody("POST", "/admin/clients", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	return string(resp), nil
+}
+
+// ListClients returns the client certs issued by the bridge. It requires
+// an admin bridge conf, and a bridge served with `--admin-api`.
+func (c *Client) ListClients() ([]bridge.IssuedClient, error) {
+	resp, err := c.doRequest("GET", "/admin/clients")
+	if err != nil {
+		return nil, err
+	}
+
+	var out []bridge.IssuedClient
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("invalid clients list: %s", err)
+	}
+	return out, nil
+}
+
+// RevokeRequest asks the bridge to revoke a client cert by `Serial`, or
+// all those issued to `Name`.
+type RevokeRequest struct {
+	Serial string `json:"serial,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// RevokeClient revokes client certs, and returns them. It requires an
+// admin bridge conf, and a bridge served with `--admin-api`.
+func (c *Client) RevokeClient(req RevokeRequest) ([]bridge.IssuedClient, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doRequestWithBody("POST", "/admin/revoke", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	var out []bridge.IssuedClient
+	if err := json.Unmarshal(resp, &out); err != nil {
+		return nil, fmt.Errorf("invalid revocation response: %s", err)
+	}
+	return out, nil
+}
+
+// GetSecretString returns the secret as a string, which can't be zeroed
+// once done with it. Use `GetSecret` to wipe the value after use.
 func (c *Client) GetSecretString(key string) (string, error) {
 	resp, err := c.GetSecret(key)
 	if err != nil {
@@ -124,12 +246,16 @@ func (c *Client) ChooseEndpoint() (err error) {
 }
 
 func (c *Client) doRequest(method string, path string) ([]byte, error) {
+	return c.doRequestWithBody(method, path, nil)
+}
+
+func (c *Client) doRequestWithBody(method string, path string, body io.Reader) ([]byte, error) {
 	if c.chosenEndpoint == nil {
 		return nil, fmt.Errorf("endpoint not configured, have you called ChooseEndpoint() first ?")
 	}
 
 	dest := c.chosenEndpoint.String() + path
-	req, err := http.NewRequest(method, dest, nil)
+	req, err := http.NewRequest(method, dest, body)
 	if err != nil {
 		return nil, err
 	}
@@ -151,3 +277,13 @@ func (c *Client) doRequest(method string, path string) ([]byte, error) {
 
 	return cnt, nil
 }
+
+// escapeKey escapes each `/`-separated segment of a key, so keys can
+// contain characters like `#` or `?`.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
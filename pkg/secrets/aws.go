@@ -0,0 +1,272 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Prefixes of the keys served by `AWSProvider`.
+const (
+	AWSSecretsManagerPrefix = "aws-sm:"
+	AWSSSMPrefix            = "aws-ssm:"
+)
+
+// AWSCredentials sign the requests to AWS.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// AWSProvider serves secrets from AWS Secrets Manager, with keys like
+// `aws-sm:ci/npm`, and SSM Parameter Store, with keys like
+// `aws-ssm:/ci/npm_token`. SecureString parameters are decrypted.
+// Values are fetched on each request.
+//
+// JSON secrets can be picked apart with the `json` codec, as in
+// `json(.token):aws-sm:ci/npm`.
+type AWSProvider struct {
+	Region      string
+	Credentials AWSCredentials
+
+	// Endpoints override the regional AWS endpoints, to use a local
+	// stand-in.
+	SecretsManagerEndpoint string
+	SSMEndpoint            string
+
+	Client *http.Client
+}
+
+func NewAWSProvider(region string, creds AWSCredentials) *AWSProvider {
+	return &AWSProvider{
+		Region:      region,
+		Credentials: creds,
+		Client:      &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *AWSProvider) Get(key string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(key, AWSSecretsManagerPrefix):
+		return p.getSecretValue(strings.TrimPrefix(key, AWSSecretsManagerPrefix))
+	case strings.HasPrefix(key, AWSSSMPrefix):
+		return p.getParameter(strings.TrimPrefix(key, AWSSSMPrefix))
+	}
+	return nil, nil
+}
+
+// List returns nothing, as AWS keys are looked up on demand.
+func (p *AWSProvider) List() ([]string, error) {
+	return nil, nil
+}
+
+// Prefixes implements `Prefixer`.
+func (p *AWSProvider) Prefixes() []string {
+	return []string{AWSSecretsManagerPrefix, AWSSSMPrefix}
+}
+
+func (p *AWSProvider) getSecretValue(name string) ([]byte, error) {
+	var resp struct {
+		SecretString *string
+		// SecretBinary is base64 in the response, which `[]byte` decodes.
+		SecretBinary []byte
+	}
+	found, err := p.call("secretsmanager", p.SecretsManagerEndpoint, "secretsmanager.GetSecretValue", map[string]interface{}{
+		"SecretId": name,
+	}, &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	if resp.SecretString != nil {
+		return []byte(*resp.SecretString), nil
+	}
+	return resp.SecretBinary, nil
+}
+
+func (p *AWSProvider) getParameter(name string) ([]byte, error) {
+	var resp struct {
+		Parameter struct {
+			Value string
+		}
+	}
+	found, err := p.call("ssm", p.SSMEndpoint, "AmazonSSM.GetParameter", map[string]interface{}{
+		"Name":           name,
+		"WithDecryption": true,
+	}, &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+	return []byte(resp.Parameter.Value), nil
+}
+
+// call makes an AWS JSON 1.1 API call. `found` is false when AWS says
+// the secret or parameter doesn't exist.
+func (p *AWSProvider) call(service, endpoint, target string, params interface{}, out interface{}) (found bool, err error) {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, p.Region)
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimRight(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signAWSv4(req, body, p.Credentials, p.Region, service, time.Now())
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	cnt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if resp.StatusCode != 200 {
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(cnt, &awsErr)
+		if strings.HasSuffix(awsErr.Type, "ResourceNotFoundException") || strings.HasSuffix(awsErr.Type, "ParameterNotFound") {
+			return false, nil
+		}
+		if awsErr.Type == "" {
+			return false, fmt.Errorf("aws %s: status %d: %s", target, resp.StatusCode, strings.TrimSpace(string(cnt)))
+		}
+		return false, fmt.Errorf("aws %s: %s: %s", target, awsErr.Type, awsErr.Message)
+	}
+
+	if err := json.Unmarshal(cnt, out); err != nil {
+		return false, fmt.Errorf("aws %s: invalid response: %s", target, err)
+	}
+	return true, nil
+}
+
+// LoadAWSConfig finds credentials and region the way the AWS CLI does:
+// from `AWS_ACCESS_KEY_ID` and friends, then from the profile in
+// `~/.aws/credentials` and `~/.aws/config`. An empty `profile` means
+// `$AWS_PROFILE`, or `default`. An explicit `profile` takes precedence
+// over the environment variables. `region` is empty when none is
+// configured.
+func LoadAWSConfig(profile string) (creds AWSCredentials, region string, err error) {
+	region = os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	if profile == "" {
+		creds = AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+		profile = os.Getenv("AWS_PROFILE")
+		if profile == "" {
+			profile = "default"
+		}
+	}
+
+	home := os.Getenv("HOME")
+	credsFile := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credsFile == "" {
+		credsFile = filepath.Join(home, ".aws", "credentials")
+	}
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(home, ".aws", "config")
+	}
+
+	config, err := readINIFile(configFile)
+	if err != nil {
+		return creds, "", err
+	}
+	configSection := config["profile "+profile]
+	if profile == "default" && configSection == nil {
+		configSection = config["default"]
+	}
+
+	if creds.AccessKeyID == "" {
+		credentials, err := readINIFile(credsFile)
+		if err != nil {
+			return creds, "", err
+		}
+
+		// Like the AWS CLI, credentials can also be in the config file.
+		section := credentials[profile]
+		if section == nil {
+			section = configSection
+		}
+		creds = AWSCredentials{
+			AccessKeyID:     section["aws_access_key_id"],
+			SecretAccessKey: section["aws_secret_access_key"],
+			SessionToken:    section["aws_session_token"],
+		}
+	}
+
+	if creds.AccessKeyID == "" || creds.SecretAccessKey == "" {
+		return creds, "", fmt.Errorf("no AWS credentials found in the environment, nor for profile %q", profile)
+	}
+
+	if region == "" {
+		region = configSection["region"]
+	}
+
+	return creds, region, nil
+}
+
+// readINIFile reads the sections of an AWS config file. A missing file
+// has no sections.
+func readINIFile(filename string) (map[string]map[string]string, error) {
+	sections := make(map[string]map[string]string)
+
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return sections, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var section map[string]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			section = make(map[string]string)
+			sections[name] = section
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || section == nil {
+			continue
+		}
+		section[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return sections, scanner.Err()
+}
@@ -0,0 +1,158 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAWSv4(t *testing.T) {
+	// "get-vanilla" from the AWS Signature Version 4 test suite.
+	req, _ := http.NewRequest("GET", "https://example.amazonaws.com/", nil)
+	creds := AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	now, _ := time.Parse(awsTimeFormat, "20150830T123600Z")
+
+	signAWSv4(req, nil, creds, "us-east-1", "service", now)
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31", req.Header.Get("Authorization"))
+}
+
+func TestAWSProvider(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") || r.Header.Get("X-Amz-Security-Token") != "session" {
+			w.WriteHeader(403)
+			w.Write([]byte(`{"__type":"UnrecognizedClientException","message":"bad signature"}`))
+			return
+		}
+
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.GetSecretValue":
+			switch params["SecretId"] {
+			case "ci/npm":
+				w.Write([]byte(`{"Name":"ci/npm","SecretString":"{\"token\":\"hello\"}"}`))
+			case "ci/blob":
+				w.Write([]byte(`{"Name":"ci/blob","SecretBinary":"AAEC"}`))
+			default:
+				w.WriteHeader(400)
+				w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"not found"}`))
+			}
+		case "AmazonSSM.GetParameter":
+			if params["Name"] != "/ci/npm_token" || params["WithDecryption"] != true {
+				w.WriteHeader(400)
+				w.Write([]byte(`{"__type":"ParameterNotFound"}`))
+				return
+			}
+			w.Write([]byte(`{"Parameter":{"Name":"/ci/npm_token","Type":"SecureString","Value":"hello"}}`))
+		}
+	}))
+	defer srv.Close()
+
+	p := NewAWSProvider("us-east-1", AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"})
+	p.SecretsManagerEndpoint = srv.URL
+	p.SSMEndpoint = srv.URL
+
+	val, err := p.Get("aws-sm:ci/npm")
+	assert.NoError(t, err)
+	assert.Equal(t, b(`{"token":"hello"}`), val)
+
+	val, err = p.Get("aws-sm:ci/blob")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 1, 2}, val)
+
+	val, err = p.Get("aws-sm:unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	val, err = p.Get("aws-ssm:/ci/npm_token")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	val, err = p.Get("aws-ssm:/unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	val, err = p.Get("npm_token")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	chain := NewChain(p)
+	val, err = chain.Get("json(.token):aws-sm:ci/npm")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	p.Credentials.SessionToken = ""
+	_, err = p.Get("aws-sm:ci/npm")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "bad signature")
+	}
+}
+
+func TestLoadAWSConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-aws")
+	must(t, err)
+	defer os.RemoveAll(dir)
+
+	must(t, ioutil.WriteFile(filepath.Join(dir, "credentials"), []byte(`
+[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = default-secret
+
+[ci]
+aws_access_key_id=AKIDCI
+aws_secret_access_key=ci-secret
+aws_session_token=ci-session
+`), 0600))
+	must(t, ioutil.WriteFile(filepath.Join(dir, "config"), []byte(`
+[default]
+region = us-east-1
+
+[profile ci]
+region = ca-central-1
+`), 0600))
+
+	for name, value := range map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(dir, "credentials"),
+		"AWS_CONFIG_FILE":             filepath.Join(dir, "config"),
+		"AWS_ACCESS_KEY_ID":           "",
+		"AWS_SECRET_ACCESS_KEY":       "",
+		"AWS_SESSION_TOKEN":           "",
+		"AWS_PROFILE":                 "",
+		"AWS_REGION":                  "",
+		"AWS_DEFAULT_REGION":          "",
+	} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Setenv(name, value)
+	}
+
+	creds, region, err := LoadAWSConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, AWSCredentials{AccessKeyID: "AKIDDEFAULT", SecretAccessKey: "default-secret"}, creds)
+	assert.Equal(t, "us-east-1", region)
+
+	creds, region, err = LoadAWSConfig("ci")
+	assert.NoError(t, err)
+	assert.Equal(t, AWSCredentials{AccessKeyID: "AKIDCI", SecretAccessKey: "ci-secret", SessionToken: "ci-session"}, creds)
+	assert.Equal(t, "ca-central-1", region)
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "AKIDENV")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	os.Setenv("AWS_REGION", "eu-west-1")
+	creds, region, err = LoadAWSConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, "AKIDENV", creds.AccessKeyID)
+	assert.Equal(t, "eu-west-1", region)
+
+	_, _, err = LoadAWSConfig("missing")
+	assert.Error(t, err)
+}
@@ -0,0 +1,317 @@
+package secrets
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec transforms secret values. Keys are prefixed by a chain of codecs,
+// like `hex:gunzip:key`. On `Get`, `Encode` is applied starting with the
+// codec nearest to the key (so `hex:gunzip:key` serves the hex of the
+// gunzipped value). On `Add`, `Decode` is applied in the reverse order,
+// so that `Get` with the same prefix returns the value as it was added.
+type Codec struct {
+	Encode func([]byte) ([]byte, error)
+	Decode func([]byte) ([]byte, error)
+}
+
+// CodecFactory builds a `Codec` from the argument between parentheses,
+// as in `json(.auth.token)`. The argument is empty for plain codecs.
+type CodecFactory func(arg string) (*Codec, error)
+
+// CodecError is returned for unknown codecs, or values a codec can't
+// handle.
+type CodecError struct {
+	Key string
+	Err error
+}
+
+func (e *CodecError) Error() string {
+	return fmt.Sprintf("codec error for %q: %s", e.Key, e.Err)
+}
+
+var codecsLock sync.RWMutex
+var codecs = map[string]CodecFactory{}
+
+// RegisterCodec makes a codec available as a key prefix.
+func RegisterCodec(name string, factory CodecFactory) {
+	codecsLock.Lock()
+	codecs[name] = factory
+	codecsLock.Unlock()
+}
+
+func lookupCodec(name string) CodecFactory {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	return codecs[name]
+}
+
+func init() {
+	RegisterCodec("b64", encodingCodec(base64.StdEncoding.EncodeToString, base64.StdEncoding.DecodeString))
+	RegisterCodec("b64u", encodingCodec(base64.URLEncoding.EncodeToString, base64.URLEncoding.DecodeString))
+	RegisterCodec("rb64", encodingCodec(base64.RawStdEncoding.EncodeToString, base64.RawStdEncoding.DecodeString))
+	RegisterCodec("rb64u", encodingCodec(base64.RawURLEncoding.EncodeToString, base64.RawURLEncoding.DecodeString))
+	RegisterCodec("b32", encodingCodec(base32.StdEncoding.EncodeToString, base32.StdEncoding.DecodeString))
+	RegisterCodec("hex", encodingCodec(hex.EncodeToString, hex.DecodeString))
+	RegisterCodec("url", plainCodec(&Codec{Encode: urlEscape, Decode: urlUnescape}))
+	RegisterCodec("gzip", plainCodec(&Codec{Encode: gzipValue, Decode: gunzipValue}))
+	RegisterCodec("gunzip", plainCodec(&Codec{Encode: gunzipValue, Decode: gzipValue}))
+	RegisterCodec("trim-newline", plainCodec(&Codec{Encode: trimNewline, Decode: trimNewline}))
+	RegisterCodec("json", jsonCodec)
+}
+
+// Codecs is a chain of codecs, outermost first.
+type Codecs []*Codec
+
+// Encode applies the `Get` direction of the chain.
+func (c Codecs) Encode(value []byte) (out []byte, err error) {
+	out = value
+	for i := len(c) - 1; i >= 0; i-- {
+		if out, err = c[i].Encode(out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// Decode applies the `Add` direction of the chain.
+func (c Codecs) Decode(value []byte) (out []byte, err error) {
+	out = value
+	for _, codec := range c {
+		if out, err = codec.Decode(out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// ParseKey splits the codecs prefixing `key` from the actual key. Leading
+// segments are consumed as long as they name registered codecs, so keys
+// can otherwise contain `:`. An unknown codec called with an argument,
+// like `nope(x):key`, is an error. Without one, it stays in the key, and
+// `Chain.Get` reports it if no provider serves that key.
+func ParseKey(key string) (string, Codecs, error) {
+	var chain Codecs
+	rest := key
+	for {
+		name, arg, remainder, ok := nextCodecSegment(rest)
+		if !ok {
+			return rest, chain, nil
+		}
+
+		factory := lookupCodec(name)
+		if factory == nil {
+			if arg != "" {
+				return "", nil, &CodecError{Key: key, Err: fmt.Errorf("unknown codec %q", name)}
+			}
+			return rest, chain, nil
+		}
+
+		codec, err := factory(strings.TrimSuffix(strings.TrimPrefix(arg, "("), ")"))
+		if err != nil {
+			return "", nil, &CodecError{Key: key, Err: fmt.Errorf("codec %q: %s", name, err)}
+		}
+
+		chain = append(chain, codec)
+		rest = remainder
+	}
+}
+
+// nextCodecSegment reads `name:` or `name(arg):` from the start of `s`.
+// `arg` is returned with its parentheses, and can contain `:` and
+// quoted `)`.
+func nextCodecSegment(s string) (name, arg, rest string, ok bool) {
+	i := 0
+	for i < len(s) && (isCodecNameChar(s[i])) {
+		i++
+	}
+	if i == 0 || i == len(s) {
+		return
+	}
+	name = s[:i]
+
+	if s[i] == '(' {
+		inQuote := false
+		j := i + 1
+		for ; j < len(s); j++ {
+			if s[j] == '"' {
+				inQuote = !inQuote
+			} else if s[j] == ')' && !inQuote {
+				break
+			}
+		}
+		if j >= len(s) {
+			return
+		}
+		arg = s[i : j+1]
+		i = j + 1
+	}
+
+	if i >= len(s)-1 || s[i] != ':' {
+		return
+	}
+
+	return name, arg, s[i+1:], true
+}
+
+func isCodecNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-'
+}
+
+// decodeKey strips the codecs from `key`, and decodes `value`
+// accordingly.
+func decodeKey(key string, value []byte) (string, []byte, error) {
+	key, chain, err := ParseKey(key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(chain) == 0 {
+		return key, value, nil
+	}
+
+	value, err = chain.Decode(value)
+	return key, value, err
+}
+
+func encodingCodec(encode func([]byte) string, decode func(string) ([]byte, error)) CodecFactory {
+	return plainCodec(&Codec{
+		Encode: func(in []byte) ([]byte, error) {
+			return []byte(encode(in)), nil
+		},
+		Decode: func(in []byte) ([]byte, error) {
+			return decode(string(in))
+		},
+	})
+}
+
+func plainCodec(codec *Codec) CodecFactory {
+	return func(arg string) (*Codec, error) {
+		if arg != "" {
+			return nil, fmt.Errorf("takes no argument")
+		}
+		return codec, nil
+	}
+}
+
+func gzipValue(in []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	if _, err := gz.Write(in); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func gunzipValue(in []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(in))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	return ioutil.ReadAll(gz)
+}
+
+func urlEscape(in []byte) ([]byte, error) {
+	return []byte(url.QueryEscape(string(in))), nil
+}
+
+func urlUnescape(in []byte) ([]byte, error) {
+	out, err := url.QueryUnescape(string(in))
+	return []byte(out), err
+}
+
+func trimNewline(in []byte) ([]byte, error) {
+	return bytes.TrimRight(in, "\r\n"), nil
+}
+
+// jsonCodec extracts a field from a JSON document, using a path like
+// `.auth.token`, `.items.0.name` or `.auths["registry.example.com"].auth`.
+// Strings are returned as-is, other values as JSON.
+func jsonCodec(arg string) (*Codec, error) {
+	path, err := parseJSONPath(arg)
+	if err != nil {
+		return nil, err
+	}
+
+	extract := func(in []byte) ([]byte, error) {
+		var doc interface{}
+		if err := json.Unmarshal(in, &doc); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %s", err)
+		}
+
+		for _, segment := range path {
+			switch node := doc.(type) {
+			case map[string]interface{}:
+				value, found := node[segment]
+				if !found {
+					return nil, fmt.Errorf("field %q not found", segment)
+				}
+				doc = value
+			case []interface{}:
+				idx, err := strconv.Atoi(segment)
+				if err != nil || idx < 0 || idx >= len(node) {
+					return nil, fmt.Errorf("invalid index %q", segment)
+				}
+				doc = node[idx]
+			default:
+				return nil, fmt.Errorf("can't look up %q in a scalar", segment)
+			}
+		}
+
+		if s, ok := doc.(string); ok {
+			return []byte(s), nil
+		}
+		return json.Marshal(doc)
+	}
+
+	return &Codec{Encode: extract, Decode: extract}, nil
+}
+
+func parseJSONPath(path string) (out []string, err error) {
+	if path == "" {
+		return nil, fmt.Errorf("missing path, like json(.field)")
+	}
+
+	for len(path) != 0 {
+		switch path[0] {
+		case '.':
+			path = path[1:]
+			end := strings.IndexAny(path, ".[")
+			if end == -1 {
+				end = len(path)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty field name in path")
+			}
+			out = append(out, path[:end])
+			path = path[end:]
+		case '[':
+			end := strings.Index(path, "]")
+			if end == -1 {
+				return nil, fmt.Errorf("unterminated [ in path")
+			}
+			segment := path[1:end]
+			if unquoted, err := strconv.Unquote(segment); err == nil {
+				segment = unquoted
+			}
+			out = append(out, segment)
+			path = path[end+1:]
+		default:
+			return nil, fmt.Errorf("path should start with '.' or '[', at %q", path)
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCodecChains(t *testing.T) {
+	dockerConfig := b(`{"auths": {"registry.example.com:5000": {"auth": "dXNlcjpwYXNz"}}, "list": [1, {"a": "b"}]}`)
+
+	tests := []struct {
+		note        string
+		addKey      string
+		addValue    []byte
+		getKey      string
+		expectValue []byte
+	}{
+		{"hex", "key", b("hi"), "hex:key", b("6869")},
+		{"hex decode", "hex:key", b("6869"), "key", b("hi")},
+		{"b32", "key", b("hi"), "b32:key", b("NBUQ====")},
+		{"url", "key", b("a b&c"), "url:key", b("a+b%26c")},
+		{"trim-newline", "key", b("token\r\n"), "trim-newline:key", b("token")},
+		{"gzip round-trip", "key", b("hello"), "gunzip:gzip:key", b("hello")},
+		{"decode chain", "hex:gzip:key", b("1f8b0800000000000203cb48cdc9c9070086a6103605000000"), "key", b("hello")},
+		{"json string", "config", dockerConfig, `json(.auths["registry.example.com:5000"].auth):config`, b("dXNlcjpwYXNz")},
+		{"json chain", "config", dockerConfig, `b64:json(.auths["registry.example.com:5000"].auth):config`, b("ZFhObGNqcHdZWE56")},
+		{"json non-string", "config", dockerConfig, "json(.list.1):config", b(`{"a":"b"}`)},
+		{"colons in key", "vault:secret/ci", b("v"), "b64:vault:secret/ci", b("dg==")},
+	}
+
+	for _, test := range tests {
+		store := &Store{}
+		err := store.Add(test.addKey, test.addValue)
+		assert.NoError(t, err, "Test: "+test.note)
+
+		val, err := NewChain(store).Get(test.getKey)
+		assert.NoError(t, err, "Test: "+test.note)
+		assert.Equal(t, test.expectValue, val, "Test: "+test.note)
+	}
+}
+
+func TestCodecErrors(t *testing.T) {
+	store := &Store{}
+	store.Add("key", b("not json"))
+	chain := NewChain(store)
+
+	for _, key := range []string{
+		"nope(x):key",
+		"json(.field):key",
+		"json():key",
+		"hex(x):key",
+		"gunzip:key",
+		"hexx:key",
+		"gunzp:key",
+	} {
+		_, err := chain.Get(key)
+		_, isCodecErr := err.(*CodecError)
+		assert.True(t, isCodecErr, key)
+	}
+
+	assert.Error(t, store.Add("hex:bad", b("zz")))
+}
+
+type prefixedProvider struct{}
+
+func (prefixedProvider) Get(key string) ([]byte, error) { return nil, nil }
+func (prefixedProvider) List() ([]string, error)        { return nil, nil }
+func (prefixedProvider) Prefixes() []string             { return []string{"ext:"} }
+
+func TestUnknownCodecsAndPrefixes(t *testing.T) {
+	store := &Store{}
+	store.Add("tool:key", b("value"))
+	chain := NewChain(store, prefixedProvider{})
+
+	val, err := chain.Get("tool:key")
+	assert.NoError(t, err)
+	assert.Equal(t, b("value"), val)
+
+	_, err = chain.Get("tool:missing")
+	if assert.IsType(t, &CodecError{}, err) {
+		assert.Contains(t, err.Error(), `unknown codec "tool"`)
+	}
+
+	// Missing keys under a provider's prefix are just not found.
+	val, err = chain.Get("b64:ext:missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	val, err = chain.Get("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+}
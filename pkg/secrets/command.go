@@ -0,0 +1,180 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CommandProvider serves secrets taken from the standard output of
+// shell commands, like `pass show npm` or `gcloud auth
+// print-access-token`.
+type CommandProvider struct {
+	// Timeout is the maximum time a command can run. Zero means no limit.
+	Timeout time.Duration
+	// Refresh re-runs a command when its value is older than that, on
+	// the next request. Zero means the value never expires.
+	Refresh time.Duration
+
+	commands map[string]*commandSecret
+}
+
+type commandSecret struct {
+	encodedKey string // original key, with its encoding prefix
+	command    string
+
+	lock    sync.Mutex
+	value   *LockedBuffer
+	fetched time.Time
+}
+
+func NewCommandProvider(timeout, refresh time.Duration) *CommandProvider {
+	return &CommandProvider{
+		Timeout:  timeout,
+		Refresh:  refresh,
+		commands: make(map[string]*commandSecret),
+	}
+}
+
+// Add registers `command` for `key`. `key` can be prefixed by an
+// encoding like `Store.Add` supports, to decode the command's output.
+// The command isn't run until `Get` or `Prefetch` is called.
+func (p *CommandProvider) Add(key, command string) {
+	rawKey, _, _ := decodeKey(key, nil)
+	p.commands[rawKey] = &commandSecret{
+		encodedKey: key,
+		command:    command,
+	}
+}
+
+// Prefetch runs all the commands right away, instead of lazily on the
+// first request.
+func (p *CommandProvider) Prefetch() error {
+	for key := range p.commands {
+		if _, err := p.Get(key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *CommandProvider) Get(key string) ([]byte, error) {
+	secret := p.commands[key]
+	if secret == nil {
+		return nil, nil
+	}
+
+	secret.lock.Lock()
+	defer secret.lock.Unlock()
+
+	stale := p.Refresh != 0 && time.Since(secret.fetched) > p.Refresh
+	if secret.value != nil && !stale {
+		return append([]byte{}, secret.value.Bytes()...), nil
+	}
+
+	output, err := p.run(secret.command)
+	if err != nil {
+		return nil, fmt.Errorf("command for secret %q: %s", key, err)
+	}
+	if len(output) == 0 {
+		// An empty value would be served as a missing secret.
+		return nil, fmt.Errorf("command for secret %q printed nothing", key)
+	}
+
+	_, value, err := decodeKey(secret.encodedKey, output)
+	if err != nil {
+		Wipe(output)
+		return nil, fmt.Errorf("decoding output of command for secret %q: %s", key, err)
+	}
+
+	if secret.value != nil {
+		secret.value.Destroy()
+	}
+	secret.value = NewLockedBuffer(value)
+	secret.fetched = time.Now()
+	Wipe(value)
+	Wipe(output)
+
+	return append([]byte{}, secret.value.Bytes()...), nil
+}
+
+// Size implements `Sizer`, for values already fetched.
+func (p *CommandProvider) Size(key string) (int, bool) {
+	secret := p.commands[key]
+	if secret == nil {
+		return 0, false
+	}
+
+	secret.lock.Lock()
+	defer secret.lock.Unlock()
+
+	if secret.value == nil {
+		return 0, false
+	}
+	return len(secret.value.Bytes()), true
+}
+
+// Wipe zeroes the cached command outputs.
+func (p *CommandProvider) Wipe() {
+	for _, secret := range p.commands {
+		secret.lock.Lock()
+		if secret.value != nil {
+			secret.value.Destroy()
+			secret.value = nil
+		}
+		secret.lock.Unlock()
+	}
+}
+
+func (p *CommandProvider) List() ([]string, error) {
+	var out []string
+	for key := range p.commands {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (p *CommandProvider) run(command string) ([]byte, error) {
+	ctx := context.Background()
+	if p.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// Don't wait forever on grand-children holding the pipes open after
+	// a timeout.
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("timed out after %s", p.Timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %s", err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
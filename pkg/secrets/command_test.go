@@ -0,0 +1,78 @@
+// +build !windows
+
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommandProvider(t *testing.T) {
+	p := NewCommandProvider(200*time.Millisecond, 0)
+	p.Add("plain", "printf hello")
+	p.Add("b64:encoded", "printf aGVsbG8=")
+	p.Add("failing", "echo oops >&2; exit 3")
+	p.Add("slow", "sleep 5")
+	p.Add("empty", "true")
+
+	val, err := p.Get("plain")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	val, err = p.Get("encoded")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	val, err = p.Get("unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	_, err = p.Get("failing")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "oops")
+	}
+
+	_, err = p.Get("slow")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "timed out")
+	}
+
+	_, err = p.Get("empty")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "printed nothing")
+	}
+
+	keys, _ := p.List()
+	assert.Equal(t, []string{"empty", "encoded", "failing", "plain", "slow"}, keys)
+}
+
+func TestCommandProviderRefresh(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-command")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Counts the runs, so that each one prints a different value.
+	counter := filepath.Join(dir, "runs")
+	p := NewCommandProvider(0, 20*time.Millisecond)
+	p.Add("runs", "echo run >> "+counter+" && wc -l < "+counter)
+
+	first, err := p.Get("runs")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", strings.TrimSpace(string(first)))
+
+	cached, _ := p.Get("runs")
+	assert.Equal(t, first, cached)
+
+	time.Sleep(30 * time.Millisecond)
+	refreshed, err := p.Get("runs")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", strings.TrimSpace(string(refreshed)))
+}
@@ -0,0 +1,71 @@
+package secrets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxDirDepth guards against symlink loops while walking a secrets
+// directory.
+const maxDirDepth = 16
+
+// ReadDir loads every regular file under `dir`, keyed by its path
+// relative to `dir` (using `/` as separator).
+//
+// Symlinks are followed, which is how Kubernetes projected volumes
+// expose their keys (`key -> ..data/key`, `..data -> ..2017_01_01...`).
+// Entries whose name starts with `..` are Kubernetes' internal
+// bookkeeping and are skipped, so each key shows up only once.
+func ReadDir(dir string) (map[string][]byte, error) {
+	out := make(map[string][]byte)
+	if err := readDir(dir, "", out, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func readDir(dir, prefix string, out map[string][]byte, depth int) error {
+	if depth > maxDirDepth {
+		return fmt.Errorf("%q: too many levels of directories or symlinks", dir)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "..") {
+			continue
+		}
+
+		fullPath := filepath.Join(dir, name)
+		key := path.Join(prefix, name)
+
+		// `ioutil.ReadDir` uses Lstat, follow the symlinks.
+		info, err := os.Stat(fullPath)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			if err := readDir(fullPath, key, out, depth+1); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			content, err := ioutil.ReadFile(fullPath)
+			if err != nil {
+				return err
+			}
+			out[key] = content
+		}
+	}
+
+	return nil
+}
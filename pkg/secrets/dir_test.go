@@ -0,0 +1,42 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadDirKubernetesLayout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Mimic a Kubernetes projected volume.
+	data := filepath.Join(dir, "..2017_01_01_00_00_00.000")
+	must(t, os.MkdirAll(filepath.Join(data, "nested"), 0755))
+	must(t, ioutil.WriteFile(filepath.Join(data, "token"), b("t0k3n"), 0600))
+	must(t, ioutil.WriteFile(filepath.Join(data, "nested", "key"), b("nested"), 0600))
+	must(t, os.Symlink(filepath.Base(data), filepath.Join(dir, "..data")))
+	must(t, os.Symlink("..data/token", filepath.Join(dir, "token")))
+	must(t, os.Symlink("..data/nested", filepath.Join(dir, "nested")))
+	must(t, ioutil.WriteFile(filepath.Join(dir, "plain"), b("plain"), 0600))
+
+	values, err := ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"token":      b("t0k3n"),
+		"nested/key": b("nested"),
+		"plain":      b("plain"),
+	}, values)
+}
+
+func must(t *testing.T, err error) {
+	if err != nil {
+		t.Fatal(err)
+	}
+}
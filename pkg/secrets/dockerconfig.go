@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DockerConfig is the part of Docker's `config.json` holding registry
+// credentials.
+type DockerConfig struct {
+	Auths       map[string]DockerAuth `json:"auths"`
+	CredsStore  string                `json:"credsStore,omitempty"`
+	CredHelpers map[string]string     `json:"credHelpers,omitempty"`
+}
+
+// DockerAuth holds the credentials of a registry. `Auth` is the base64
+// of `username:password`.
+type DockerAuth struct {
+	Auth          string `json:"auth,omitempty"`
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// DefaultDockerConfigPath is `$DOCKER_CONFIG/config.json`, or
+// `~/.docker/config.json`.
+func DefaultDockerConfigPath() string {
+	if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+		return filepath.Join(dir, "config.json")
+	}
+	return filepath.Join(os.Getenv("HOME"), ".docker", "config.json")
+}
+
+func ParseDockerConfig(content []byte) (*DockerConfig, error) {
+	config := &DockerConfig{}
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("invalid docker config: %s", err)
+	}
+	return config, nil
+}
+
+// DockerRegistryHost strips the scheme and path from the `auths` keys,
+// so `https://index.docker.io/v1/` becomes `index.docker.io`.
+func DockerRegistryHost(registry string) string {
+	host := registry
+	if idx := strings.Index(host, "://"); idx != -1 {
+		host = host[idx+3:]
+	}
+	if idx := strings.Index(host, "/"); idx != -1 {
+		host = host[:idx]
+	}
+	return host
+}
+
+// Credentials returns the complete credentials of the `registries`
+// (by host or as listed in `auths`), or of all registries if none are
+// given. Credentials kept by a credential helper are asked to it.
+func (c *DockerConfig) Credentials(registries []string) (map[string]DockerAuth, error) {
+	wanted := make(map[string]bool)
+	for _, registry := range registries {
+		wanted[DockerRegistryHost(registry)] = true
+	}
+
+	names := make([]string, 0, len(c.Auths))
+	for name := range c.Auths {
+		names = append(names, name)
+	}
+	for name := range c.CredHelpers {
+		if _, found := c.Auths[name]; !found {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	out := make(map[string]DockerAuth)
+	found := make(map[string]bool)
+	for _, name := range names {
+		host := DockerRegistryHost(name)
+		if len(wanted) != 0 && !wanted[host] {
+			continue
+		}
+		found[host] = true
+
+		auth, err := c.credentials(name)
+		if err != nil {
+			return nil, fmt.Errorf("registry %q: %s", name, err)
+		}
+		out[name] = auth
+	}
+
+	for host := range wanted {
+		if found[host] {
+			continue
+		}
+		return nil, fmt.Errorf("registry %q not found in docker config", host)
+	}
+
+	return out, nil
+}
+
+func (c *DockerConfig) credentials(registry string) (DockerAuth, error) {
+	auth := c.Auths[registry]
+
+	helper := c.CredHelpers[registry]
+	if helper == "" && auth.Auth == "" && auth.Username == "" && auth.IdentityToken == "" {
+		helper = c.CredsStore
+	}
+	if helper != "" {
+		var err error
+		if auth, err = dockerCredentialHelper(helper, registry); err != nil {
+			return auth, err
+		}
+	}
+
+	if auth.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return auth, fmt.Errorf("invalid auth: %s", err)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return auth, fmt.Errorf("invalid auth, expected base64 of username:password")
+		}
+		auth.Username, auth.Password = parts[0], parts[1]
+	} else if auth.Username != "" {
+		auth.Auth = base64.StdEncoding.EncodeToString([]byte(auth.Username + ":" + auth.Password))
+	}
+
+	return auth, nil
+}
+
+// dockerCredentialHelper runs `docker-credential-<helper> get`.
+func dockerCredentialHelper(helper, registry string) (DockerAuth, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get")
+	cmd.Stdin = strings.NewReader(registry)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String() + string(output))
+		return DockerAuth{}, fmt.Errorf("credential helper %q: %s: %s", helper, err, msg)
+	}
+	defer Wipe(output)
+
+	var resp struct {
+		Username string
+		Secret   string
+	}
+	if err := json.Unmarshal(output, &resp); err != nil {
+		return DockerAuth{}, fmt.Errorf("credential helper %q: invalid output: %s", helper, err)
+	}
+
+	// Helpers return identity tokens with this special username.
+	if resp.Username == "<token>" {
+		return DockerAuth{IdentityToken: resp.Secret}, nil
+	}
+	return DockerAuth{Username: resp.Username, Password: resp.Secret}, nil
+}
+
+// DockerSecrets turns registry credentials into secrets like
+// `docker/registry.example.com/password`, under `namespace`. The
+// credentials are also served as a `config.json` holding only them.
+// Registries listed under several names, like `index.docker.io` and
+// `https://index.docker.io/v1/`, must hold the same credentials.
+func DockerSecrets(namespace string, creds map[string]DockerAuth) (map[string][]byte, error) {
+	out := make(map[string][]byte)
+	filtered := &DockerConfig{Auths: make(map[string]DockerAuth)}
+
+	registries := make([]string, 0, len(creds))
+	for registry := range creds {
+		registries = append(registries, registry)
+	}
+	sort.Strings(registries)
+
+	hosts := make(map[string]string)
+	for _, registry := range registries {
+		auth := creds[registry]
+		host := DockerRegistryHost(registry)
+		if other, found := hosts[host]; found {
+			if creds[other] != auth {
+				return nil, fmt.Errorf("registries %q and %q both map to %q, with different credentials, keep only one of them", other, registry, host)
+			}
+		}
+		hosts[host] = registry
+
+		prefix := namespace + "/" + host + "/"
+		if auth.Auth != "" {
+			out[prefix+"username"] = []byte(auth.Username)
+			out[prefix+"password"] = []byte(auth.Password)
+			out[prefix+"auth"] = []byte(auth.Auth)
+		}
+		if auth.IdentityToken != "" {
+			out[prefix+"identitytoken"] = []byte(auth.IdentityToken)
+		}
+
+		filtered.Auths[registry] = DockerAuth{Auth: auth.Auth, IdentityToken: auth.IdentityToken}
+	}
+
+	config, err := json.MarshalIndent(filtered, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	out[namespace+"/config.json"] = config
+
+	return out, nil
+}
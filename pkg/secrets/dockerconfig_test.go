@@ -0,0 +1,89 @@
+package secrets
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var dockerConfig = []byte(`{
+	"auths": {
+		"https://index.docker.io/v1/": {"auth": "Ym9iOmh1bnRlcjI="},
+		"registry.example.com": {"username": "ci", "password": "s3cret"},
+		"gcr.io": {"identitytoken": "tok"}
+	},
+	"HttpHeaders": {"User-Agent": "Docker-Client"}
+}`)
+
+func TestDockerSecrets(t *testing.T) {
+	config, err := ParseDockerConfig(dockerConfig)
+	assert.NoError(t, err)
+
+	creds, err := config.Credentials(nil)
+	assert.NoError(t, err)
+	assert.Len(t, creds, 3)
+
+	secrets, err := DockerSecrets("docker", creds)
+	assert.NoError(t, err)
+	assert.Equal(t, b("bob"), secrets["docker/index.docker.io/username"])
+	assert.Equal(t, b("hunter2"), secrets["docker/index.docker.io/password"])
+	assert.Equal(t, b("Ym9iOmh1bnRlcjI="), secrets["docker/index.docker.io/auth"])
+	assert.Equal(t, b("ci"), secrets["docker/registry.example.com/username"])
+	assert.Equal(t, b("Y2k6czNjcmV0"), secrets["docker/registry.example.com/auth"])
+	assert.Equal(t, b("tok"), secrets["docker/gcr.io/identitytoken"])
+	assert.Nil(t, secrets["docker/gcr.io/password"])
+}
+
+func TestDockerSecretsFiltered(t *testing.T) {
+	config, err := ParseDockerConfig(dockerConfig)
+	assert.NoError(t, err)
+
+	creds, err := config.Credentials([]string{"index.docker.io"})
+	assert.NoError(t, err)
+
+	secrets, err := DockerSecrets("docker", creds)
+	assert.NoError(t, err)
+	assert.Len(t, secrets, 4)
+
+	filtered := &DockerConfig{}
+	assert.NoError(t, json.Unmarshal(secrets["docker/config.json"], filtered))
+	assert.Equal(t, map[string]DockerAuth{
+		"https://index.docker.io/v1/": {Auth: "Ym9iOmh1bnRlcjI="},
+	}, filtered.Auths)
+
+	_, err = config.Credentials([]string{"quay.io"})
+	assert.Error(t, err)
+
+	config, err = ParseDockerConfig([]byte(`{"auths": {"bad": {"auth": "bm9jb2xvbg=="}}}`))
+	assert.NoError(t, err)
+	_, err = config.Credentials(nil)
+	assert.Error(t, err)
+}
+
+func TestDockerSecretsSameHost(t *testing.T) {
+	config, err := ParseDockerConfig([]byte(`{"auths": {
+		"https://index.docker.io/v1/": {"auth": "Ym9iOmh1bnRlcjI="},
+		"index.docker.io": {"auth": "Ym9iOmh1bnRlcjI="}
+	}}`))
+	assert.NoError(t, err)
+	creds, err := config.Credentials(nil)
+	assert.NoError(t, err)
+
+	secrets, err := DockerSecrets("docker", creds)
+	assert.NoError(t, err)
+	assert.Equal(t, b("bob"), secrets["docker/index.docker.io/username"])
+
+	config, err = ParseDockerConfig([]byte(`{"auths": {
+		"https://index.docker.io/v1/": {"auth": "Ym9iOmh1bnRlcjI="},
+		"index.docker.io": {"auth": "YWxpY2U6czNjcmV0"}
+	}}`))
+	assert.NoError(t, err)
+	creds, err = config.Credentials(nil)
+	assert.NoError(t, err)
+
+	_, err = DockerSecrets("docker", creds)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "different credentials")
+	}
+}
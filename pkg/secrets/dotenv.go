@@ -0,0 +1,120 @@
+package secrets
+
+import (
+	"fmt"
+	"strings"
+)
+
+type DotenvEntry struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// ParseDotenv reads `.env`-style `KEY=value` pairs. It supports
+// comments, blank lines, an optional `export ` prefix, single-quoted
+// (literal) values, double-quoted values with `\n`, `\t`, `\"`, `\\`
+// escapes, and quoted values spanning multiple lines.
+//
+// Keys are kept as-is, so they can carry the `b64:` style prefixes
+// understood by `Store.Add`.
+func ParseDotenv(content []byte) (out []DotenvEntry, err error) {
+	lines := strings.Split(strings.Replace(string(content), "\r\n", "\n", -1), "\n")
+
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSpace(lines[i])
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "export ") || strings.HasPrefix(line, "export\t") {
+			line = strings.TrimSpace(line[len("export"):])
+		}
+
+		eq := strings.Index(line, "=")
+		if eq == -1 {
+			return nil, fmt.Errorf("line %d: expected KEY=value", lineNo)
+		}
+
+		key := strings.TrimSpace(line[:eq])
+		if key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("line %d: invalid key %q", lineNo, key)
+		}
+
+		rest := strings.TrimLeft(line[eq+1:], " \t")
+		var value string
+
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			quote := rest[0]
+			raw := rest[1:]
+			// Accumulate lines until the closing quote.
+			for {
+				if end := closingQuote(raw, quote); end != -1 {
+					if trailing := strings.TrimSpace(raw[end+1:]); trailing != "" && !strings.HasPrefix(trailing, "#") {
+						return nil, fmt.Errorf("line %d: unexpected characters after closing quote", lineNo)
+					}
+					raw = raw[:end]
+					break
+				}
+				i++
+				if i >= len(lines) {
+					return nil, fmt.Errorf("line %d: unterminated quoted value for %q", lineNo, key)
+				}
+				raw += "\n" + lines[i]
+			}
+
+			if quote == '"' {
+				value = unescapeDoubleQuoted(raw)
+			} else {
+				value = raw
+			}
+		} else {
+			if idx := strings.Index(rest, " #"); idx != -1 {
+				rest = rest[:idx]
+			}
+			value = strings.TrimSpace(rest)
+		}
+
+		out = append(out, DotenvEntry{Key: key, Value: value, Line: lineNo})
+	}
+
+	return out, nil
+}
+
+func closingQuote(s string, quote byte) int {
+	for i := 0; i < len(s); i++ {
+		if quote == '"' && s[i] == '\\' {
+			i++
+			continue
+		}
+		if s[i] == quote {
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeDoubleQuoted(s string) string {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+		i++
+		switch s[i] {
+		case 'n':
+			out = append(out, '\n')
+		case 'r':
+			out = append(out, '\r')
+		case 't':
+			out = append(out, '\t')
+		case '"', '\\', '$':
+			out = append(out, s[i])
+		default:
+			out = append(out, '\\', s[i])
+		}
+	}
+	return string(out)
+}
@@ -0,0 +1,58 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDotenv(t *testing.T) {
+	content := `
+# A comment
+PLAIN=value
+export EXPORTED=exported # trailing comment
+SPACED = with spaces
+EMPTY=
+SINGLE='it is # not \n a comment'
+DOUBLE="line1\nline2 \"quoted\""
+b64:ENCODED=aGVsbG8=
+MULTI="first
+second"
+PEM='-----BEGIN KEY-----
+abc
+-----END KEY-----'
+`
+
+	entries, err := ParseDotenv([]byte(content))
+	assert.NoError(t, err)
+
+	got := map[string]string{}
+	for _, e := range entries {
+		got[e.Key] = e.Value
+	}
+
+	assert.Equal(t, map[string]string{
+		"PLAIN":       "value",
+		"EXPORTED":    "exported",
+		"SPACED":      "with spaces",
+		"EMPTY":       "",
+		"SINGLE":      `it is # not \n a comment`,
+		"DOUBLE":      "line1\nline2 \"quoted\"",
+		"b64:ENCODED": "aGVsbG8=",
+		"MULTI":       "first\nsecond",
+		"PEM":         "-----BEGIN KEY-----\nabc\n-----END KEY-----",
+	}, got)
+	assert.Equal(t, 12, entries[len(entries)-1].Line)
+}
+
+func TestParseDotenvErrors(t *testing.T) {
+	for _, content := range []string{
+		"NOEQUALS",
+		"BAD KEY=value",
+		`OPEN="never closed`,
+		`=value`,
+	} {
+		_, err := ParseDotenv([]byte(content))
+		assert.Error(t, err, content)
+	}
+}
@@ -0,0 +1,208 @@
+package secrets
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay coalesces the bursts of events produced by editors and
+// by Kubernetes' atomic symlink swaps.
+var reloadDelay = 100 * time.Millisecond
+
+// FileWatcher reloads file-backed secrets into a `Store` when they
+// change on disk.
+//
+// Parent directories are watched rather than the files themselves, so
+// that atomic renames and Kubernetes `..data` symlink swaps are picked
+// up. A file that is missing while it's being replaced keeps its
+// previous value.
+type FileWatcher struct {
+	store   *Store
+	watcher *fsnotify.Watcher
+
+	lock      sync.Mutex
+	files     []fileSource
+	dirs      []string
+	forgotten map[string]bool
+}
+
+type fileSource struct {
+	key      string // can include an encoding prefix
+	filename string
+}
+
+func NewFileWatcher(store *Store) (*FileWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	fw := &FileWatcher{
+		store:   store,
+		watcher: watcher,
+	}
+	go fw.run()
+
+	return fw, nil
+}
+
+// AddFile watches `filename`, reloading it under `key`, which can be
+// prefixed by an encoding like `Store.Add` supports.
+func (fw *FileWatcher) AddFile(key, filename string) error {
+	if err := fw.watcher.Add(filepath.Dir(filename)); err != nil {
+		return err
+	}
+
+	fw.lock.Lock()
+	fw.files = append(fw.files, fileSource{key: key, filename: filename})
+	fw.lock.Unlock()
+
+	return nil
+}
+
+// AddDir watches `dir` and its sub-directories, like loaded by `ReadDir`.
+func (fw *FileWatcher) AddDir(dir string) error {
+	if err := fw.watchTree(dir); err != nil {
+		return err
+	}
+
+	fw.lock.Lock()
+	fw.dirs = append(fw.dirs, dir)
+	fw.lock.Unlock()
+
+	return nil
+}
+
+// Forget stops reloading `key`, which can be prefixed by an encoding,
+// from its file or directory. It's called when the key is set or
+// removed by other means, like the admin API.
+func (fw *FileWatcher) Forget(key string) {
+	rawKey, _, _ := ParseKey(key)
+
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+
+	var files []fileSource
+	for _, src := range fw.files {
+		if srcKey, _, _ := ParseKey(src.key); srcKey != rawKey {
+			files = append(files, src)
+		}
+	}
+	fw.files = files
+
+	if fw.forgotten == nil {
+		fw.forgotten = make(map[string]bool)
+	}
+	fw.forgotten[rawKey] = true
+}
+
+func (fw *FileWatcher) Close() error {
+	return fw.watcher.Close()
+}
+
+func (fw *FileWatcher) watchTree(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return fw.watcher.Add(path)
+		}
+		return nil
+	})
+}
+
+func (fw *FileWatcher) run() {
+	var pending <-chan time.Time
+	for {
+		select {
+		case _, ok := <-fw.watcher.Events:
+			if !ok {
+				return
+			}
+			if pending == nil {
+				pending = time.After(reloadDelay)
+			}
+		case err, ok := <-fw.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Println("secrets: file watcher error:", err)
+		case <-pending:
+			pending = nil
+			fw.reload()
+		}
+	}
+}
+
+func (fw *FileWatcher) reload() {
+	fw.lock.Lock()
+	files := fw.files
+	dirs := fw.dirs
+	fw.lock.Unlock()
+
+	fresh := make(map[string][]byte)
+
+	for _, src := range files {
+		content, err := ioutil.ReadFile(src.filename)
+		if err != nil {
+			log.Printf("secrets: couldn't reload %q, keeping previous value: %s\n", src.filename, err)
+			continue
+		}
+
+		key, value, err := decodeKey(src.key, content)
+		if err != nil {
+			log.Printf("secrets: couldn't decode reloaded %q, keeping previous value: %s\n", src.filename, err)
+			continue
+		}
+		fresh[key] = value
+	}
+
+	for _, dir := range dirs {
+		values, err := ReadDir(dir)
+		if err != nil {
+			log.Printf("secrets: couldn't reload directory %q, keeping previous values: %s\n", dir, err)
+			continue
+		}
+		for key, value := range values {
+			fresh[key] = value
+		}
+
+		// Pick up newly created sub-directories.
+		if err := fw.watchTree(dir); err != nil {
+			log.Printf("secrets: couldn't watch directory %q: %s\n", dir, err)
+		}
+	}
+
+	// Held until the store is updated, so that a key forgotten meanwhile
+	// isn't brought back.
+	fw.lock.Lock()
+	defer fw.lock.Unlock()
+
+	changed := make(map[string][]byte)
+	fw.store.lock.RLock()
+	for key, value := range fresh {
+		if !fw.forgotten[key] && !bytes.Equal(fw.store.Secrets[key], value) {
+			changed[key] = value
+		}
+	}
+	fw.store.lock.RUnlock()
+	if len(changed) == 0 {
+		return
+	}
+
+	fw.store.SetAll(changed)
+	for key, value := range changed {
+		log.Printf("secrets: reloaded secret %q (%d bytes)\n", key, len(value))
+	}
+	for _, value := range fresh {
+		Wipe(value)
+	}
+}
@@ -0,0 +1,98 @@
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileWatcherReload(t *testing.T) {
+	reloadDelay = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "secrets-watch")
+	must(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "token")
+	must(t, ioutil.WriteFile(filename, b("b25l"), 0600))
+
+	store := &Store{}
+	must(t, store.Add("b64:token", b("b25l")))
+
+	fw, err := NewFileWatcher(store)
+	must(t, err)
+	defer fw.Close()
+	must(t, fw.AddFile("b64:token", filename))
+
+	// Atomic replace, through a rename.
+	must(t, ioutil.WriteFile(filename+".tmp", b("dHdv"), 0600))
+	must(t, os.Rename(filename+".tmp", filename))
+	waitForValue(t, store, "token", b("two"))
+
+	// A missing file keeps its previous value.
+	must(t, os.Remove(filename))
+	time.Sleep(50 * time.Millisecond)
+	val, _ := store.Get("token")
+	assert.Equal(t, b("two"), val)
+
+	must(t, ioutil.WriteFile(filename, b("dGhyZWU="), 0600))
+	waitForValue(t, store, "token", b("three"))
+}
+
+func waitForValue(t *testing.T, store *Store, key string, expected []byte) {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if val, _ := store.Get(key); string(val) == string(expected) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	val, _ := store.Get(key)
+	t.Fatalf("timed out waiting for %q to become %q, still %q", key, expected, val)
+}
+
+func TestFileWatcherForget(t *testing.T) {
+	reloadDelay = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "secrets-watch")
+	must(t, err)
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "token")
+	must(t, ioutil.WriteFile(filename, b("one"), 0600))
+	secretsDir := filepath.Join(dir, "secrets")
+	must(t, os.Mkdir(secretsDir, 0700))
+	must(t, ioutil.WriteFile(filepath.Join(secretsDir, "npm"), b("npm-one"), 0600))
+	must(t, ioutil.WriteFile(filepath.Join(secretsDir, "docker"), b("docker-one"), 0600))
+
+	store := &Store{}
+	store.Set("token", b("one"))
+	store.Set("npm", b("npm-one"))
+	store.Set("docker", b("docker-one"))
+
+	fw, err := NewFileWatcher(store)
+	must(t, err)
+	defer fw.Close()
+	must(t, fw.AddFile("token", filename))
+	must(t, fw.AddDir(secretsDir))
+
+	// Like the admin API removing one key and overwriting another.
+	fw.Forget("token")
+	store.Delete("token")
+	fw.Forget("b64:npm")
+	must(t, store.Add("npm", b("admin")))
+
+	must(t, ioutil.WriteFile(filename, b("two"), 0600))
+	must(t, ioutil.WriteFile(filepath.Join(secretsDir, "npm"), b("npm-two"), 0600))
+	must(t, ioutil.WriteFile(filepath.Join(secretsDir, "docker"), b("docker-two"), 0600))
+	waitForValue(t, store, "docker", b("docker-two"))
+
+	_, found := store.Size("token")
+	assert.False(t, found)
+	val, _ := store.Get("npm")
+	assert.Equal(t, b("admin"), val)
+}
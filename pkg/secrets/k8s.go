@@ -0,0 +1,113 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// K8sSecret is a Kubernetes Secret manifest.
+type K8sSecret struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string            `yaml:"name"`
+		Namespace string            `yaml:"namespace"`
+		Labels    map[string]string `yaml:"labels"`
+	} `yaml:"metadata"`
+	Data       map[string]string `yaml:"data"`
+	StringData map[string]string `yaml:"stringData"`
+}
+
+// k8sDocument is any manifest, to pick the Secrets out of multi-document
+// files and `List`s.
+type k8sDocument struct {
+	K8sSecret `yaml:",inline"`
+	Items     []K8sSecret `yaml:"items"`
+}
+
+var yamlDocumentSeparatorRE = regexp.MustCompile(`(?m)^---[ \t]*(#.*)?$`)
+
+// ParseK8sSecrets reads the Secrets of a YAML file, which can hold many
+// documents separated by `---`, `List`s of Secrets, and other kinds of
+// manifests, which are skipped.
+func ParseK8sSecrets(content []byte) (out []K8sSecret, err error) {
+	for i, doc := range yamlDocumentSeparatorRE.Split(string(content), -1) {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+
+		parsed := k8sDocument{}
+		if err := yaml.Unmarshal([]byte(doc), &parsed); err != nil {
+			return nil, fmt.Errorf("document %d: %s", i+1, err)
+		}
+
+		candidates := []K8sSecret{parsed.K8sSecret}
+		if parsed.Kind == "List" || strings.HasSuffix(parsed.Kind, "List") {
+			candidates = parsed.Items
+		}
+		for _, secret := range candidates {
+			if secret.Kind != "Secret" {
+				continue
+			}
+			if secret.Metadata.Name == "" {
+				return nil, fmt.Errorf("document %d: Secret without a name", i+1)
+			}
+			out = append(out, secret)
+		}
+	}
+	return out, nil
+}
+
+// Values returns the entries of the Secret, with `data` decoded from
+// base64. Like the Kubernetes API does, `stringData` entries take
+// precedence over `data`.
+func (s K8sSecret) Values() (map[string][]byte, error) {
+	out := make(map[string][]byte)
+	for key, encoded := range s.Data {
+		value, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+		if err != nil {
+			return nil, fmt.Errorf("secret %q: invalid base64 for %q: %s", s.Metadata.Name, key, err)
+		}
+		out[key] = value
+	}
+	for key, value := range s.StringData {
+		out[key] = []byte(value)
+	}
+	return out, nil
+}
+
+// Matches tells whether the Secret is in `namespace` (any if empty), and
+// has all the `labels`.
+func (s K8sSecret) Matches(namespace string, labels map[string]string) bool {
+	if namespace != "" && s.Metadata.Namespace != namespace {
+		return false
+	}
+	for key, value := range labels {
+		if actual, found := s.Metadata.Labels[key]; !found || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelSelector reads equality-based selectors, like
+// `app=ci,tier==build`.
+func ParseLabelSelector(selector string) (map[string]string, error) {
+	out := make(map[string]string)
+	for _, requirement := range strings.Split(selector, ",") {
+		requirement = strings.TrimSpace(requirement)
+		if requirement == "" {
+			continue
+		}
+
+		parts := strings.SplitN(requirement, "=", 2)
+		if len(parts) != 2 || strings.HasSuffix(parts[0], "!") || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid label selector %q, expected key=value", requirement)
+		}
+		out[strings.TrimSpace(parts[0])] = strings.TrimSpace(strings.TrimPrefix(parts[1], "="))
+	}
+	return out, nil
+}
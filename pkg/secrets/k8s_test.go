@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var k8sManifests = []byte(`apiVersion: v1
+kind: Secret
+metadata:
+  name: npm
+  namespace: ci
+  labels:
+    app: builds
+type: Opaque
+data:
+  token: aGVsbG8=
+  multiline: |
+    aGVs
+    bG8=
+stringData:
+  registry: https://registry.npmjs.org
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: not-a-secret
+data:
+  key: value
+--- # another one
+apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: Secret
+  metadata:
+    name: deploy
+    namespace: prod
+  data:
+    key: d29ybGQ=
+  stringData:
+    key: overridden
+`)
+
+func TestParseK8sSecrets(t *testing.T) {
+	secrets, err := ParseK8sSecrets(k8sManifests)
+	assert.NoError(t, err)
+	if !assert.Len(t, secrets, 2) {
+		return
+	}
+
+	assert.Equal(t, "npm", secrets[0].Metadata.Name)
+	values, err := secrets[0].Values()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"token":     b("hello"),
+		"multiline": b("hello"),
+		"registry":  b("https://registry.npmjs.org"),
+	}, values)
+
+	assert.Equal(t, "deploy", secrets[1].Metadata.Name)
+	values, err = secrets[1].Values()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"key": b("overridden")}, values)
+
+	assert.True(t, secrets[0].Matches("", nil))
+	assert.True(t, secrets[0].Matches("ci", map[string]string{"app": "builds"}))
+	assert.False(t, secrets[0].Matches("prod", nil))
+	assert.False(t, secrets[0].Matches("", map[string]string{"app": "web"}))
+	assert.False(t, secrets[1].Matches("", map[string]string{"app": "builds"}))
+
+	secrets, err = ParseK8sSecrets([]byte("kind: Secret\nmetadata:\n  name: bad\ndata:\n  key: '%%%'\n"))
+	assert.NoError(t, err)
+	_, err = secrets[0].Values()
+	assert.Error(t, err)
+
+	_, err = ParseK8sSecrets([]byte("kind: Secret\ndata: {}\n"))
+	assert.Error(t, err)
+}
+
+func TestParseLabelSelector(t *testing.T) {
+	labels, err := ParseLabelSelector("app=builds, tier==ci")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"app": "builds", "tier": "ci"}, labels)
+
+	_, err = ParseLabelSelector("app!=builds")
+	assert.Error(t, err)
+
+	_, err = ParseLabelSelector("app")
+	assert.Error(t, err)
+}
@@ -0,0 +1,83 @@
+package secrets
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrExhausted is returned by `Store.Get` for a secret which has been
+// read as many times as allowed, or whose TTL has passed.
+var ErrExhausted = errors.New("secret exhausted")
+
+// Limits restricts how a secret can be read. Zero values mean no limit.
+type Limits struct {
+	// MaxReads is the number of times the secret can be read.
+	MaxReads int
+	// TTL is how long the secret can be read, from the time the limits
+	// are set.
+	TTL time.Duration
+}
+
+type readLimit struct {
+	Limits
+	reads   int
+	expires time.Time
+}
+
+// exhausted tells whether the secret can't be read anymore.
+func (l *readLimit) exhausted() bool {
+	if l.MaxReads != 0 && l.reads >= l.MaxReads {
+		return true
+	}
+	return !l.expires.IsZero() && time.Now().After(l.expires)
+}
+
+// SetLimits restricts reads of `key`, which can carry an encoding prefix.
+// Once exhausted, the value is zeroed and `Get` returns `ErrExhausted`.
+func (s *Store) SetLimits(key string, limits Limits) {
+	key, _, _ = ParseKey(key)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if limits == (Limits{}) {
+		delete(s.limits, key)
+		return
+	}
+
+	limit := &readLimit{Limits: limits}
+	if limits.TTL != 0 {
+		limit.expires = time.Now().Add(limits.TTL)
+	}
+
+	if s.limits == nil {
+		s.limits = make(map[string]*readLimit)
+	}
+	s.limits[key] = limit
+}
+
+// checkLimit counts a read of `key`, and tells whether it's allowed. The
+// value is destroyed when the last allowed read happens. Must be called
+// with the lock held.
+func (s *Store) checkLimit(key string) error {
+	limit := s.limits[key]
+	if limit == nil {
+		return nil
+	}
+
+	if limit.exhausted() {
+		s.destroy(key)
+		return ErrExhausted
+	}
+
+	limit.reads++
+	return nil
+}
+
+// destroyIfExhausted zeroes the value of `key` after its last allowed
+// read. Must be called with the lock held.
+func (s *Store) destroyIfExhausted(key string) {
+	if limit := s.limits[key]; limit != nil && limit.exhausted() {
+		s.destroy(key)
+	}
+}
@@ -0,0 +1,42 @@
+package secrets
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxReads(t *testing.T) {
+	store := &Store{}
+	store.Add("b64:once", b("aGVsbG8="))
+	store.SetLimits("b64:once", Limits{MaxReads: 2})
+
+	for i := 0; i < 2; i++ {
+		val, err := store.Get("once")
+		assert.NoError(t, err)
+		assert.Equal(t, b("hello"), val)
+	}
+
+	val, err := store.Get("b64:once")
+	assert.Equal(t, ErrExhausted, err)
+	assert.Nil(t, val)
+	assert.Nil(t, store.Secrets["once"])
+
+	_, err = NewChain(store).Get("once")
+	assert.Equal(t, ErrExhausted, err)
+}
+
+func TestTTL(t *testing.T) {
+	store := &Store{}
+	store.Add("short", b("lived"))
+	store.SetLimits("short", Limits{TTL: 20 * time.Millisecond})
+
+	val, err := store.Get("short")
+	assert.NoError(t, err)
+	assert.Equal(t, b("lived"), val)
+
+	time.Sleep(30 * time.Millisecond)
+	_, err = store.Get("short")
+	assert.Equal(t, ErrExhausted, err)
+}
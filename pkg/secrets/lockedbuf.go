@@ -0,0 +1,21 @@
+package secrets
+
+// LockedBuffer holds a secret value outside of the garbage-collected
+// heap where the platform allows it: on Linux, the memory is locked
+// (never swapped) and excluded from core dumps. `Destroy` zeroes it.
+type LockedBuffer struct {
+	data   []byte
+	mapped bool
+}
+
+// Bytes returns the locked memory itself. It's invalid after `Destroy`.
+func (b *LockedBuffer) Bytes() []byte {
+	return b.data
+}
+
+// Wipe zeroes `b`, to call once a copy of a secret isn't needed anymore.
+func Wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
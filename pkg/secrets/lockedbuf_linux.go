@@ -0,0 +1,53 @@
+package secrets
+
+import (
+	"log"
+	"sync"
+
+	"golang.org/x/sys/unix"
+)
+
+// madvDontDump is MADV_DONTDUMP, missing from the vendored `unix`
+// package on some architectures. Its value is the same on all of them.
+const madvDontDump = 0x10
+
+var mlockWarning sync.Once
+
+// NewLockedBuffer copies `value` into a locked memory region.
+func NewLockedBuffer(value []byte) *LockedBuffer {
+	if len(value) == 0 {
+		return &LockedBuffer{data: []byte{}}
+	}
+
+	data, err := unix.Mmap(-1, 0, len(value), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		mlockWarning.Do(func() {
+			log.Println("WARNING: couldn't allocate locked memory for secrets, using regular memory:", err)
+		})
+		return &LockedBuffer{data: append([]byte{}, value...)}
+	}
+
+	if err := unix.Mlock(data); err != nil {
+		mlockWarning.Do(func() {
+			log.Println("WARNING: couldn't mlock secrets, they could be swapped to disk (raise `ulimit -l`):", err)
+		})
+	}
+	_ = unix.Madvise(data, madvDontDump)
+
+	copy(data, value)
+
+	return &LockedBuffer{data: data, mapped: true}
+}
+
+// Destroy zeroes and releases the memory.
+func (b *LockedBuffer) Destroy() {
+	if b.data == nil {
+		return
+	}
+	Wipe(b.data)
+	if b.mapped {
+		_ = unix.Munlock(b.data)
+		_ = unix.Munmap(b.data)
+	}
+	b.data = nil
+}
@@ -0,0 +1,15 @@
+// +build !linux
+
+package secrets
+
+// NewLockedBuffer copies `value`. Memory locking is only implemented on
+// Linux, so this is regular memory which is at least zeroed on `Destroy`.
+func NewLockedBuffer(value []byte) *LockedBuffer {
+	return &LockedBuffer{data: append([]byte{}, value...)}
+}
+
+// Destroy zeroes the memory.
+func (b *LockedBuffer) Destroy() {
+	Wipe(b.data)
+	b.data = nil
+}
@@ -0,0 +1,33 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreWipe(t *testing.T) {
+	store := &Store{}
+	store.Set("key", b("value"))
+	store.Set("empty", b(""))
+
+	val, err := store.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, b("value"), val)
+
+	// Callers get a copy they can wipe.
+	Wipe(val)
+	val, _ = store.Get("key")
+	assert.Equal(t, b("value"), val)
+
+	val, _ = store.Get("empty")
+	assert.NotNil(t, val)
+
+	store.Set("key", b("other"))
+	val, _ = store.Get("key")
+	assert.Equal(t, b("other"), val)
+
+	store.Wipe()
+	val, _ = store.Get("key")
+	assert.Nil(t, val)
+}
@@ -0,0 +1,131 @@
+package secrets
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metadata describes a secret, to help consumers use it. None of it is
+// secret.
+type Metadata struct {
+	Description string `json:"description,omitempty"`
+	// Filename is the suggested name when writing the secret to disk.
+	Filename string `json:"filename,omitempty"`
+	// Mode is the suggested octal file mode, like "0600".
+	Mode        string     `json:"mode,omitempty"`
+	ContentType string     `json:"content_type,omitempty"`
+	Expires     *time.Time `json:"expires,omitempty"`
+}
+
+// MetadataProvider is optionally implemented by providers which know
+// about their secrets' metadata.
+type MetadataProvider interface {
+	Metadata(key string) (Metadata, bool)
+}
+
+// Validate checks the fields which have a format.
+func (m Metadata) Validate() error {
+	if m.Mode != "" {
+		if _, err := m.FileMode(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FileMode parses `Mode`, defaulting to 0600.
+func (m Metadata) FileMode() (os.FileMode, error) {
+	if m.Mode == "" {
+		return 0600, nil
+	}
+	mode, err := strconv.ParseUint(m.Mode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid file mode %q, expected octal like 0600", m.Mode)
+	}
+	return os.FileMode(mode), nil
+}
+
+// Expired tells whether the secret shouldn't be served anymore.
+func (m Metadata) Expired() bool {
+	return m.Expires != nil && time.Now().After(*m.Expires)
+}
+
+// Merge returns `m` with the non-empty fields of `other` on top.
+func (m Metadata) Merge(other Metadata) Metadata {
+	if other.Description != "" {
+		m.Description = other.Description
+	}
+	if other.Filename != "" {
+		m.Filename = other.Filename
+	}
+	if other.Mode != "" {
+		m.Mode = other.Mode
+	}
+	if other.ContentType != "" {
+		m.ContentType = other.ContentType
+	}
+	if other.Expires != nil {
+		m.Expires = other.Expires
+	}
+	return m
+}
+
+// Metadata headers, sent along with secret values.
+const (
+	HeaderDescription = "X-Secret-Description"
+	HeaderFilename    = "X-Secret-Filename"
+	HeaderMode        = "X-Secret-Mode"
+	HeaderExpires     = "X-Secret-Expires"
+)
+
+// WriteHeaders sets the metadata response headers. The `Content-Type`
+// header is left to the caller, as codecs change the content.
+func (m Metadata) WriteHeaders(h http.Header) {
+	if m.Description != "" {
+		h.Set(HeaderDescription, strings.Replace(m.Description, "\n", " ", -1))
+	}
+	if m.Filename != "" {
+		h.Set(HeaderFilename, m.Filename)
+	}
+	if m.Mode != "" {
+		h.Set(HeaderMode, m.Mode)
+	}
+	if m.Expires != nil {
+		h.Set(HeaderExpires, m.Expires.UTC().Format(time.RFC3339))
+	}
+}
+
+// Metadata returns the metadata for `key`. Metadata set on the chain
+// overrides the one from providers.
+func (c *Chain) Metadata(key string) Metadata {
+	var md Metadata
+	for i := len(c.providers) - 1; i >= 0; i-- {
+		if p, ok := c.providers[i].(MetadataProvider); ok {
+			if providerMD, found := p.Metadata(key); found {
+				md = md.Merge(providerMD)
+			}
+		}
+	}
+
+	c.metadataLock.RLock()
+	defer c.metadataLock.RUnlock()
+	if override, found := c.metadata[key]; found {
+		md = md.Merge(override)
+	}
+	return md
+}
+
+// SetMetadata attaches metadata to `key`, whichever provider serves it.
+func (c *Chain) SetMetadata(key string, md Metadata) {
+	c.metadataLock.Lock()
+	defer c.metadataLock.Unlock()
+
+	if c.metadata == nil {
+		c.metadata = make(map[string]Metadata)
+	}
+	c.metadata[key] = c.metadata[key].Merge(md)
+}
@@ -0,0 +1,47 @@
+package secrets
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type metaStore struct {
+	Store
+	meta map[string]Metadata
+}
+
+func (m *metaStore) Metadata(key string) (Metadata, bool) {
+	md, found := m.meta[key]
+	return md, found
+}
+
+func TestChainMetadata(t *testing.T) {
+	provider := &metaStore{meta: map[string]Metadata{
+		"id_rsa": {Description: "Deploy key", Mode: "0400"},
+	}}
+	chain := NewChain(provider)
+	chain.SetMetadata("id_rsa", Metadata{Mode: "0600", Filename: "id_rsa"})
+
+	md := chain.Metadata("id_rsa")
+	assert.Equal(t, Metadata{Description: "Deploy key", Mode: "0600", Filename: "id_rsa"}, md)
+
+	mode, err := md.FileMode()
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), mode)
+
+	assert.Error(t, Metadata{Mode: "rw"}.Validate())
+	assert.Error(t, Metadata{Mode: "1777"}.Validate())
+
+	past := time.Now().Add(-time.Minute)
+	assert.True(t, Metadata{Expires: &past}.Expired())
+	assert.False(t, md.Expired())
+
+	h := http.Header{}
+	md.WriteHeaders(h)
+	assert.Equal(t, "0600", h.Get(HeaderMode))
+	assert.Equal(t, "Deploy key", h.Get(HeaderDescription))
+}
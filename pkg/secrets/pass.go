@@ -0,0 +1,223 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PassPrefix marks the keys served by `PassProvider`.
+const PassPrefix = "pass:"
+
+// PassProvider serves entries of a `pass` password store, decrypted
+// with the local `gpg` binary (and its agent) on the first request for
+// each entry.
+//
+// Keys look like:
+//
+//	pass:ci/npm            the whole entry
+//	pass:ci/npm#password   the first line, which `pass` holds the password on
+//	pass:ci/npm#login      the value of a `login: ...` line
+type PassProvider struct {
+	// Dir is the password store, usually `~/.password-store`.
+	Dir string
+	// GPG is the gpg binary, `gpg` by default.
+	GPG string
+	// Timeout is the maximum time gpg can run, including the time to
+	// type in a passphrase. Zero means no limit.
+	Timeout time.Duration
+
+	lock       sync.Mutex
+	entries    map[string]*LockedBuffer
+	entryLocks map[string]*sync.Mutex // one gpg run at a time per entry
+}
+
+func NewPassProvider(dir string) *PassProvider {
+	return &PassProvider{
+		Dir:     dir,
+		GPG:     "gpg",
+		entries:    make(map[string]*LockedBuffer),
+		entryLocks: make(map[string]*sync.Mutex),
+	}
+}
+
+// DefaultPassDir is `$PASSWORD_STORE_DIR`, or `~/.password-store`.
+func DefaultPassDir() string {
+	if dir := os.Getenv("PASSWORD_STORE_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.Getenv("HOME"), ".password-store")
+}
+
+func (p *PassProvider) Get(key string) ([]byte, error) {
+	if !strings.HasPrefix(key, PassPrefix) {
+		return nil, nil
+	}
+
+	entry := strings.TrimPrefix(key, PassPrefix)
+	var field string
+	if idx := strings.LastIndex(entry, "#"); idx != -1 {
+		entry, field = entry[:idx], entry[idx+1:]
+	}
+
+	content, err := p.decrypt(entry)
+	if err != nil || content == nil {
+		return nil, err
+	}
+
+	if field == "" {
+		return content, nil
+	}
+	defer Wipe(content)
+
+	value := passField(content, field)
+	if value == nil {
+		return nil, nil
+	}
+	return append([]byte{}, value...), nil
+}
+
+// List returns nothing, as entries are looked up on demand.
+func (p *PassProvider) List() ([]string, error) {
+	return nil, nil
+}
+
+// Prefixes implements `Prefixer`.
+func (p *PassProvider) Prefixes() []string {
+	return []string{PassPrefix}
+}
+
+// Wipe zeroes the decrypted entries.
+func (p *PassProvider) Wipe() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for entry, buf := range p.entries {
+		buf.Destroy()
+		delete(p.entries, entry)
+	}
+}
+
+// decrypt returns a copy of the decrypted `entry`, or nil if it isn't
+// in the store.
+func (p *PassProvider) decrypt(entry string) ([]byte, error) {
+	for _, segment := range strings.Split(entry, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("invalid pass entry %q", entry)
+		}
+	}
+
+	if value := p.cached(entry); value != nil {
+		return value, nil
+	}
+
+	// gpg can wait on a passphrase prompt for long, so `p.lock` isn't
+	// held meanwhile, only the lock of the entry. Those waiting on it
+	// find the value in the cache.
+	p.lock.Lock()
+	entryLock := p.entryLocks[entry]
+	if entryLock == nil {
+		entryLock = &sync.Mutex{}
+		p.entryLocks[entry] = entryLock
+	}
+	p.lock.Unlock()
+
+	entryLock.Lock()
+	defer entryLock.Unlock()
+
+	if value := p.cached(entry); value != nil {
+		return value, nil
+	}
+
+	filename := filepath.Join(p.Dir, filepath.FromSlash(entry)+".gpg")
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	output, err := p.runGPG(filename)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting pass entry %q: %s", entry, err)
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if old := p.entries[entry]; old != nil {
+		old.Destroy()
+	}
+	p.entries[entry] = NewLockedBuffer(output)
+	Wipe(output)
+
+	return append([]byte{}, p.entries[entry].Bytes()...), nil
+}
+
+// cached returns a copy of the decrypted `entry`, or nil if it wasn't
+// decrypted yet.
+func (p *PassProvider) cached(entry string) []byte {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if buf := p.entries[entry]; buf != nil {
+		return append([]byte{}, buf.Bytes()...)
+	}
+	return nil
+}
+
+func (p *PassProvider) runGPG(filename string) ([]byte, error) {
+	ctx := context.Background()
+	if p.Timeout != 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, p.GPG, "--quiet", "--yes", "--decrypt", filename)
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("gpg timed out after %s", p.Timeout)
+	}
+	if err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%s: %s", err, msg)
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// passField extracts `field` from a multi-line entry: `password` is the
+// first line, other fields are read from `field: value` lines.
+func passField(content []byte, field string) []byte {
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if i == 0 {
+			if field == "password" {
+				return line
+			}
+			continue
+		}
+
+		idx := bytes.IndexByte(line, ':')
+		if idx == -1 {
+			continue
+		}
+		if string(bytes.TrimSpace(line[:idx])) == field {
+			return bytes.TrimSpace(line[idx+1:])
+		}
+	}
+	return nil
+}
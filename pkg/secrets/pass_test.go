@@ -0,0 +1,125 @@
+// +build !windows
+
+package secrets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPassProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-pass")
+	must(t, err)
+	defer os.RemoveAll(dir)
+
+	// A stand-in for gpg, which "decrypts" by copying the file, and
+	// counts its runs.
+	fakeGPG := filepath.Join(dir, "gpg")
+	runs := filepath.Join(dir, "runs")
+	must(t, ioutil.WriteFile(fakeGPG, []byte("#!/bin/sh\necho run >> "+runs+"\ncat \"$4\"\n"), 0700))
+
+	store := filepath.Join(dir, "store")
+	must(t, os.MkdirAll(filepath.Join(store, "ci"), 0700))
+	must(t, ioutil.WriteFile(filepath.Join(store, "ci", "npm.gpg"), []byte("s3cret\nlogin: bob\nurl : https://registry.npmjs.org\n"), 0600))
+	must(t, ioutil.WriteFile(filepath.Join(store, "broken.gpg"), []byte("x"), 0600))
+
+	p := NewPassProvider(store)
+	p.GPG = fakeGPG
+
+	val, err := p.Get("pass:ci/npm")
+	assert.NoError(t, err)
+	assert.Equal(t, b("s3cret\nlogin: bob\nurl : https://registry.npmjs.org\n"), val)
+
+	val, err = p.Get("pass:ci/npm#password")
+	assert.NoError(t, err)
+	assert.Equal(t, b("s3cret"), val)
+
+	val, err = p.Get("pass:ci/npm#login")
+	assert.NoError(t, err)
+	assert.Equal(t, b("bob"), val)
+
+	val, err = p.Get("pass:ci/npm#url")
+	assert.NoError(t, err)
+	assert.Equal(t, b("https://registry.npmjs.org"), val)
+
+	val, err = p.Get("pass:ci/npm#missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	val, err = p.Get("pass:ci/unknown")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	val, err = p.Get("npm")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	_, err = p.Get("pass:../store/ci/npm")
+	assert.Error(t, err)
+
+	// Decrypted once, on the first request.
+	cnt, _ := ioutil.ReadFile(runs)
+	assert.Equal(t, 1, strings.Count(string(cnt), "run"))
+
+	p.Wipe()
+	val, err = p.Get("pass:ci/npm#password")
+	assert.NoError(t, err)
+	assert.Equal(t, b("s3cret"), val)
+	cnt, _ = ioutil.ReadFile(runs)
+	assert.Equal(t, 2, strings.Count(string(cnt), "run"))
+
+	must(t, ioutil.WriteFile(fakeGPG, []byte("#!/bin/sh\necho 'decryption failed: No secret key' >&2\nexit 2\n"), 0700))
+	_, err = p.Get("pass:broken")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "No secret key")
+	}
+}
+
+func TestPassProviderSlowGPG(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets-pass")
+	must(t, err)
+	defer os.RemoveAll(dir)
+
+	// Like gpg waiting on a passphrase prompt for the "slow" entry.
+	fakeGPG := filepath.Join(dir, "gpg")
+	runs := filepath.Join(dir, "runs")
+	must(t, ioutil.WriteFile(fakeGPG, []byte("#!/bin/sh\necho run >> "+runs+"\ncase \"$4\" in *slow.gpg) sleep 1;; esac\ncat \"$4\"\n"), 0700))
+
+	store := filepath.Join(dir, "store")
+	must(t, os.MkdirAll(store, 0700))
+	must(t, ioutil.WriteFile(filepath.Join(store, "slow.gpg"), []byte("slow"), 0600))
+	must(t, ioutil.WriteFile(filepath.Join(store, "fast.gpg"), []byte("fast"), 0600))
+
+	p := NewPassProvider(store)
+	p.GPG = fakeGPG
+
+	slow := make(chan []byte, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			val, _ := p.Get("pass:slow")
+			slow <- val
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// Neither other entries nor wiping wait on the slow entry.
+	start := time.Now()
+	val, err := p.Get("pass:fast")
+	assert.NoError(t, err)
+	assert.Equal(t, b("fast"), val)
+	p.Wipe()
+	assert.True(t, time.Since(start) < 500*time.Millisecond, "blocked by the slow entry")
+
+	assert.Equal(t, b("slow"), <-slow)
+	assert.Equal(t, b("slow"), <-slow)
+
+	// The slow entry was decrypted once, for both requests.
+	cnt, _ := ioutil.ReadFile(runs)
+	assert.Equal(t, 2, strings.Count(string(cnt), "run"))
+}
@@ -0,0 +1,251 @@
+package secrets
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider is a source of secrets. `Get` returns a nil value and a nil
+// error when the provider doesn't know about `key`, so that the next
+// provider in a `Chain` can be consulted. The returned value belongs to
+// the caller, who should `Wipe` it once done.
+//
+// Keys handed to providers never carry the codec prefixes (`b64:` and
+// friends), those are dealt with by the `Chain`.
+type Provider interface {
+	Get(key string) ([]byte, error)
+	List() ([]string, error)
+}
+
+// Watcher is optionally implemented by providers whose values can
+// change after startup. `notify` is called with the key that changed.
+type Watcher interface {
+	Watch(notify func(key string)) error
+}
+
+// Sizer is optionally implemented by providers which know the size of a
+// value without reading it (reading can count towards limits, or run
+// commands).
+type Sizer interface {
+	Size(key string) (size int, found bool)
+}
+
+// Prefixer is optionally implemented by providers serving the keys under
+// prefixes of their own, like `vault:`. Unknown keys under those aren't
+// reported as unknown codecs.
+type Prefixer interface {
+	Prefixes() []string
+}
+
+// KeyInfo describes a secret, without its value.
+type KeyInfo struct {
+	Key string `json:"key"`
+	// Size is -1 when unknown until read.
+	Size int `json:"size"`
+}
+
+// Wiper is optionally implemented by providers holding values in
+// memory, to zero them before the process exits.
+type Wiper interface {
+	Wipe()
+}
+
+// Chain queries a list of providers in order. Providers earlier in the
+// chain take precedence: the first one returning a non-nil value for a
+// key wins, and an error stops the lookup right there.
+type Chain struct {
+	providers []Provider
+
+	metadataLock sync.RWMutex
+	metadata     map[string]Metadata
+}
+
+func NewChain(providers ...Provider) *Chain {
+	return &Chain{providers: providers}
+}
+
+// Append adds a provider with the lowest precedence.
+func (c *Chain) Append(p Provider) {
+	c.providers = append(c.providers, p)
+}
+
+// Prepend adds a provider with the highest precedence.
+func (c *Chain) Prepend(p Provider) {
+	c.providers = append([]Provider{p}, c.providers...)
+}
+
+// Get looks up `key`, which can be prefixed by a chain of codecs, like
+// `b64:gunzip:key`. Codec problems are returned as `*CodecError`,
+// including a missing key starting with something like an unknown codec
+// (`hexx:key`), which no provider claims as its prefix.
+func (c *Chain) Get(key string) ([]byte, error) {
+	fullKey := key
+	key, codecs, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, p := range c.providers {
+		value, err := getParsed(p, key)
+		if err == ErrExhausted {
+			return nil, err
+		}
+		if err != nil {
+			return nil, fmt.Errorf("fetching %q: %s", key, err)
+		}
+		if value == nil {
+			continue
+		}
+
+		if len(codecs) != 0 {
+			encoded, err := codecs.Encode(value)
+			if err != nil {
+				Wipe(value)
+				return nil, &CodecError{Key: key, Err: err}
+			}
+			encoded = append([]byte{}, encoded...)
+			Wipe(value)
+			value = encoded
+		}
+		return value, nil
+	}
+
+	if name, _, _, ok := nextCodecSegment(key); ok && !c.claims(name+":") {
+		return nil, &CodecError{Key: fullKey, Err: fmt.Errorf("unknown codec %q", name)}
+	}
+	return nil, nil
+}
+
+// getParsed gets a `key` already stripped of its codecs. `Store.Get`
+// would parse them again.
+func getParsed(p Provider, key string) ([]byte, error) {
+	if store, ok := p.(*Store); ok {
+		return store.get(key)
+	}
+	return p.Get(key)
+}
+
+// claims tells whether a provider serves keys under `prefix`.
+func (c *Chain) claims(prefix string) bool {
+	for _, p := range c.providers {
+		prefixer, ok := p.(Prefixer)
+		if !ok {
+			continue
+		}
+		for _, claimed := range prefixer.Prefixes() {
+			if claimed == prefix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// List returns the sorted, de-duplicated keys of all providers.
+func (c *Chain) List() ([]string, error) {
+	seen := make(map[string]bool)
+	var out []string
+	for _, p := range c.providers {
+		keys, err := p.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range keys {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// ListInfo returns the keys starting with `prefix`, with their size when
+// known. Use a `prefix` ending with `/` to list a namespace.
+func (c *Chain) ListInfo(prefix string) ([]KeyInfo, error) {
+	seen := make(map[string]bool)
+	var out []KeyInfo
+	for _, p := range c.providers {
+		keys, err := p.List()
+		if err != nil {
+			return nil, err
+		}
+		sizer, _ := p.(Sizer)
+		for _, key := range keys {
+			if seen[key] || !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			seen[key] = true
+
+			info := KeyInfo{Key: key, Size: -1}
+			if sizer != nil {
+				if size, found := sizer.Size(key); found {
+					info.Size = size
+				}
+			}
+			out = append(out, info)
+		}
+	}
+	sort.Sort(byKey(out))
+	return out, nil
+}
+
+// Has tells whether `key`, without codecs, is served. Keys listed by a
+// provider are found without fetching them. Others are fetched, for
+// providers like Vault that don't list their keys.
+func (c *Chain) Has(key string) (bool, error) {
+	list, err := c.ListInfo(key)
+	if err != nil {
+		return false, err
+	}
+	if len(list) != 0 && list[0].Key == key {
+		return true, nil
+	}
+
+	for _, p := range c.providers {
+		value, err := getParsed(p, key)
+		if err != nil {
+			return false, err
+		}
+		if value != nil {
+			Wipe(value)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type byKey []KeyInfo
+
+func (k byKey) Len() int           { return len(k) }
+func (k byKey) Less(i, j int) bool { return k[i].Key < k[j].Key }
+func (k byKey) Swap(i, j int)      { k[i], k[j] = k[j], k[i] }
+
+// Watch registers `notify` with all the providers that implement
+// `Watcher`.
+func (c *Chain) Watch(notify func(key string)) error {
+	for _, p := range c.providers {
+		w, ok := p.(Watcher)
+		if !ok {
+			continue
+		}
+		if err := w.Watch(notify); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wipe zeroes the values held by all the providers that implement
+// `Wiper`.
+func (c *Chain) Wipe() {
+	for _, p := range c.providers {
+		if w, ok := p.(Wiper); ok {
+			w.Wipe()
+		}
+	}
+}
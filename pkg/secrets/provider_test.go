@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingProvider struct{}
+
+func (failingProvider) Get(key string) ([]byte, error) { return nil, fmt.Errorf("boom") }
+func (failingProvider) List() ([]string, error)        { return []string{"broken"}, nil }
+
+func TestChainPrecedence(t *testing.T) {
+	first := &Store{}
+	first.Add("shared", b("first"))
+	second := &Store{}
+	second.Add("shared", b("second"))
+	second.Add("only-second", b("hello"))
+
+	chain := NewChain(first, second)
+
+	val, err := chain.Get("shared")
+	assert.NoError(t, err)
+	assert.Equal(t, b("first"), val)
+
+	val, err = chain.Get("b64:only-second")
+	assert.NoError(t, err)
+	assert.Equal(t, b("aGVsbG8="), val)
+
+	val, err = chain.Get("missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	chain.Prepend(failingProvider{})
+	_, err = chain.Get("shared")
+	assert.Error(t, err)
+
+	keys, err := chain.List()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"broken", "only-second", "shared"}, keys)
+}
+
+func TestChainListInfo(t *testing.T) {
+	store := &Store{}
+	store.Add("npm/token", b("abc"))
+	store.Add("npm/registry/url", b("https://"))
+	store.Add("npmrc", b("x"))
+
+	commands := NewCommandProvider(0, 0)
+	commands.Add("npm/lazy", "printf lazy")
+
+	chain := NewChain(store, commands)
+
+	list, err := chain.ListInfo("npm/")
+	assert.NoError(t, err)
+	assert.Equal(t, []KeyInfo{
+		{Key: "npm/lazy", Size: -1},
+		{Key: "npm/registry/url", Size: 8},
+		{Key: "npm/token", Size: 3},
+	}, list)
+
+	list, err = chain.ListInfo("")
+	assert.NoError(t, err)
+	assert.Len(t, list, 4)
+}
+
+// unlistedProvider serves keys without listing them, like Vault.
+type unlistedProvider struct{}
+
+func (unlistedProvider) Get(key string) ([]byte, error) {
+	if key == "vault:secret/npm" {
+		return []byte("token"), nil
+	}
+	return nil, nil
+}
+func (unlistedProvider) List() ([]string, error) { return nil, nil }
+
+func TestChainHas(t *testing.T) {
+	store := &Store{}
+	store.Add("npm/token", b("value"))
+	chain := NewChain(store, unlistedProvider{})
+
+	for key, expected := range map[string]bool{
+		"npm/token":        true,
+		"npm":              false,
+		"vault:secret/npm": true,
+		"vault:secret/git": false,
+	} {
+		found, err := chain.Has(key)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, found, key)
+	}
+
+	chain.Prepend(failingProvider{})
+	_, err := chain.Has("vault:secret/npm")
+	assert.Error(t, err)
+}
@@ -1,65 +1,170 @@
 package secrets
 
 import (
-	"encoding/base64"
-	"strings"
+	"sort"
+	"sync"
 )
 
+// Store is the in-memory `Provider`, filled from the command-line. It is
+// safe for concurrent use, values can be swapped while serving.
+//
+// Values are kept in `LockedBuffer`s, `Secrets` points into them and
+// must not be modified directly.
 type Store struct {
 	Secrets map[string][]byte
+
+	lock     sync.RWMutex
+	buffers  map[string]*LockedBuffer
+	limits   map[string]*readLimit
+	watchers []func(key string)
 }
 
 func (s *Store) Add(key string, value []byte) (err error) {
-	if strings.HasPrefix(key, "b64:") {
-		key = key[4:]
-		value, err = base64.StdEncoding.DecodeString(string(value))
-	} else if strings.HasPrefix(key, "b64u:") {
-		key = key[5:]
-		value, err = base64.URLEncoding.DecodeString(string(value))
-	} else if strings.HasPrefix(key, "rb64:") {
-		key = key[5:]
-		value, err = base64.RawStdEncoding.DecodeString(string(value))
-	} else if strings.HasPrefix(key, "rb64u:") {
-		key = key[6:]
-		value, err = base64.RawURLEncoding.DecodeString(string(value))
-	}
+	key, value, err = decodeKey(key, value)
 	if err != nil {
 		return
 	}
 
+	s.Set(key, value)
+
+	return nil
+}
+
+// Set stores `value` under `key` verbatim, without looking for an
+// encoding prefix. `value` is copied to locked memory.
+func (s *Store) Set(key string, value []byte) {
+	s.SetAll(map[string][]byte{key: value})
+}
+
+// SetAll stores all `values` at once, so that readers never observe a
+// partially updated set.
+func (s *Store) SetAll(values map[string][]byte) {
+	s.lock.Lock()
 	if s.Secrets == nil {
 		s.Secrets = make(map[string][]byte)
+		s.buffers = make(map[string]*LockedBuffer)
 	}
-	s.Secrets[key] = value
+	for key, value := range values {
+		buf := NewLockedBuffer(value)
 
-	return nil
+		if previous := s.buffers[key]; previous != nil {
+			previous.Destroy()
+		}
+		s.buffers[key] = buf
+		s.Secrets[key] = buf.Bytes()
+	}
+	watchers := s.watchers
+	s.lock.Unlock()
+
+	for key := range values {
+		for _, notify := range watchers {
+			notify(key)
+		}
+	}
+}
+
+// Delete removes `key`, zeroing its value.
+func (s *Store) Delete(key string) {
+	s.lock.Lock()
+	s.destroy(key)
+	delete(s.limits, key)
+	watchers := s.watchers
+	s.lock.Unlock()
+
+	for _, notify := range watchers {
+		notify(key)
+	}
 }
 
-func (s *Store) Get(key string) []byte {
-	var encoder func([]byte) string
-	switch {
-	case strings.HasPrefix(key, "b64:"):
-		key = key[4:]
-		encoder = base64.StdEncoding.EncodeToString
-	case strings.HasPrefix(key, "b64u:"):
-		key = key[5:]
-		encoder = base64.URLEncoding.EncodeToString
-	case strings.HasPrefix(key, "rb64:"):
-		key = key[5:]
-		encoder = base64.RawStdEncoding.EncodeToString
-	case strings.HasPrefix(key, "rb64u:"):
-		key = key[6:]
-		encoder = base64.RawURLEncoding.EncodeToString
+// Get returns a copy of the value, which the caller should `Wipe` once
+// done with it. `key` can be prefixed by codecs, for direct callers: a
+// `Chain` parses them once, and calls `get` with the bare key.
+func (s *Store) Get(key string) ([]byte, error) {
+	key, codecs, err := ParseKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := s.get(key)
+	if value == nil || len(codecs) == 0 {
+		return value, err
+	}
+	defer Wipe(value)
+
+	encoded, err := codecs.Encode(value)
+	if err != nil {
+		return nil, &CodecError{Key: key, Err: err}
+	}
+	// Codecs like `trim-newline` return a sub-slice of their input.
+	return append([]byte{}, encoded...), nil
+}
+
+// get returns a copy of the value of the bare `key`, counting the read.
+func (s *Store) get(key string) ([]byte, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if err := s.checkLimit(key); err != nil {
+		return nil, err
 	}
 
 	secret := s.Secrets[key]
 	if secret == nil {
-		return nil
+		return nil, nil
+	}
+
+	value := append([]byte{}, secret...)
+	s.destroyIfExhausted(key)
+	return value, nil
+}
+
+// destroy zeroes and removes the value of `key`. Must be called with the
+// lock held.
+func (s *Store) destroy(key string) {
+	if buf := s.buffers[key]; buf != nil {
+		buf.Destroy()
+	}
+	delete(s.buffers, key)
+	delete(s.Secrets, key)
+}
+
+// Wipe zeroes and removes all the values, to call before exiting.
+func (s *Store) Wipe() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, buf := range s.buffers {
+		buf.Destroy()
 	}
+	s.buffers = nil
+	s.Secrets = nil
+}
+
+func (s *Store) List() ([]string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-	if encoder != nil {
-		secret = []byte(encoder(secret))
+	var out []string
+	for key := range s.Secrets {
+		out = append(out, key)
 	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// Size implements `Sizer`.
+func (s *Store) Size(key string) (int, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
 
-	return secret
+	value, found := s.Secrets[key]
+	return len(value), found
+}
+
+// Watch implements `Watcher`, `notify` is called each time a key is set.
+func (s *Store) Watch(notify func(key string)) error {
+	s.lock.Lock()
+	s.watchers = append(s.watchers, notify)
+	s.lock.Unlock()
+	return nil
 }
@@ -95,7 +95,8 @@ func TestSecrets(t *testing.T) {
 		if test.addSucceeds {
 			assert.NoError(t, err, "Test: "+test.note)
 
-			getVal := store.Get(test.getKey)
+			getVal, err := store.Get(test.getKey)
+			assert.NoError(t, err, "Test: "+test.note)
 			assert.Equal(t, test.expectValue, getVal, "Test: "+test.note)
 
 		} else {
@@ -0,0 +1,121 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateProvider serves secrets rendered from Go `text/template`s,
+// typically whole config files like `.npmrc` embedding a token.
+//
+// Templates can use:
+//
+//	{{ secret "key" }}     value of another secret, codecs like "b64:key" work too
+//	{{ base64 .. }}        standard base64 encoding
+//	{{ base64url .. }}     URL-safe base64 encoding
+//	{{ trim .. }}          strip surrounding whitespace and newlines
+//	{{ json .. }}          quote as a JSON string
+//
+// Templates are rendered on each request, so they reflect reloaded
+// values.
+type TemplateProvider struct {
+	source    Provider
+	templates map[string]*template.Template
+}
+
+// NewTemplateProvider renders templates with secrets taken from
+// `source`, usually the `Chain` the provider is part of.
+func NewTemplateProvider(source Provider) *TemplateProvider {
+	return &TemplateProvider{
+		source:    source,
+		templates: make(map[string]*template.Template),
+	}
+}
+
+func (p *TemplateProvider) Add(key, text string) error {
+	tpl, err := template.New(key).Funcs(p.funcs(nil)).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return err
+	}
+	p.templates[key] = tpl
+	return nil
+}
+
+func (p *TemplateProvider) Get(key string) ([]byte, error) {
+	return p.render(key, map[string]bool{})
+}
+
+func (p *TemplateProvider) List() ([]string, error) {
+	var out []string
+	for key := range p.templates {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (p *TemplateProvider) render(key string, visiting map[string]bool) ([]byte, error) {
+	tpl := p.templates[key]
+	if tpl == nil {
+		return nil, nil
+	}
+
+	if visiting[key] {
+		return nil, fmt.Errorf("template %q references itself", key)
+	}
+	visiting[key] = true
+	defer delete(visiting, key)
+
+	tpl, err := tpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := tpl.Funcs(p.funcs(visiting)).Execute(buf, nil); err != nil {
+		return nil, fmt.Errorf("rendering template %q: %s", key, err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (p *TemplateProvider) funcs(visiting map[string]bool) template.FuncMap {
+	return template.FuncMap{
+		"secret": func(key string) (string, error) {
+			var value []byte
+			var err error
+			if rawKey, codecs, _ := ParseKey(key); p.templates[rawKey] != nil {
+				value, err = p.render(rawKey, visiting)
+				if err == nil && value != nil {
+					value, err = codecs.Encode(value)
+				}
+			} else {
+				value, err = p.source.Get(key)
+			}
+			if err != nil {
+				return "", err
+			}
+			if value == nil {
+				return "", fmt.Errorf("secret %q not found", key)
+			}
+			defer Wipe(value)
+			return string(value), nil
+		},
+		"base64": func(s string) string {
+			return base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"base64url": func(s string) string {
+			return base64.URLEncoding.EncodeToString([]byte(s))
+		},
+		"trim": strings.TrimSpace,
+		"json": func(s string) (string, error) {
+			out, err := json.Marshal(s)
+			return string(out), err
+		},
+	}
+}
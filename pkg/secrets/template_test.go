@@ -0,0 +1,38 @@
+package secrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplateProvider(t *testing.T) {
+	store := &Store{}
+	store.Add("npm_token", b("abc123\n"))
+	store.Add("user", b("bob"))
+
+	chain := NewChain(store)
+	templates := NewTemplateProvider(chain)
+	chain.Append(templates)
+
+	assert.NoError(t, templates.Add(".npmrc", `//registry.npmjs.org/:_authToken={{ secret "npm_token" | trim }}`))
+	assert.NoError(t, templates.Add("auth", `{{ printf "%s:%s" (secret "user") (secret "npm_token" | trim) | base64 }}`))
+	assert.NoError(t, templates.Add("config.json", `{"auth": {{ secret "auth" | json }}, "b64": "{{ secret "b64:user" }}"}`))
+	assert.NoError(t, templates.Add("missing", `{{ secret "nope" }}`))
+	assert.NoError(t, templates.Add("loop", `{{ secret "loop" }}`))
+	assert.Error(t, templates.Add("invalid", `{{ secret `))
+
+	val, err := chain.Get(".npmrc")
+	assert.NoError(t, err)
+	assert.Equal(t, "//registry.npmjs.org/:_authToken=abc123", string(val))
+
+	val, err = chain.Get("config.json")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"auth": "Ym9iOmFiYzEyMw==", "b64": "Ym9i"}`, string(val))
+
+	_, err = chain.Get("missing")
+	assert.Error(t, err)
+
+	_, err = chain.Get("loop")
+	assert.Error(t, err)
+}
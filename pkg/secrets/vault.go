@@ -0,0 +1,232 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VaultPrefix marks the keys served by `VaultProvider`.
+const VaultPrefix = "vault:"
+
+// VaultProvider serves secrets from a HashiCorp Vault KV v2 engine.
+// Keys look like `vault:secret/data/ci#npm_token`: the API path of the
+// secret, and the field to serve. Paths can also be relative to the
+// mount, as in `vault:ci#npm_token`. Without a field, all the fields are
+// served as a JSON object.
+//
+// Only paths under the mount are served. Values are fetched from Vault
+// on each request, so they reflect rotations.
+type VaultProvider struct {
+	// Addr is the base URL of Vault, like `https://vault:8200`.
+	Addr string
+	// Mount is the path where the KV v2 engine is mounted, like
+	// `secret`.
+	Mount string
+
+	// Token authenticates with Vault. If RoleID is set, a token is
+	// obtained through AppRole instead, and renewed when it expires.
+	Token    string
+	RoleID   string
+	SecretID string
+
+	Client *http.Client
+
+	lock  sync.Mutex
+	token string
+}
+
+func NewVaultProvider(addr, mount string) *VaultProvider {
+	return &VaultProvider{
+		Addr:   strings.TrimRight(addr, "/"),
+		Mount:  strings.Trim(mount, "/"),
+		Client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (p *VaultProvider) Get(key string) ([]byte, error) {
+	if !strings.HasPrefix(key, VaultPrefix) {
+		return nil, nil
+	}
+
+	path, field, err := p.parseKey(strings.TrimPrefix(key, VaultPrefix))
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	found, err := p.request("GET", path, nil, &resp)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	if field == "" {
+		return json.Marshal(resp.Data.Data)
+	}
+
+	value, found := resp.Data.Data[field]
+	if !found {
+		return nil, nil
+	}
+	if s, ok := value.(string); ok {
+		return []byte(s), nil
+	}
+	return json.Marshal(value)
+}
+
+// List returns nothing, as Vault keys are looked up on demand.
+func (p *VaultProvider) List() ([]string, error) {
+	return nil, nil
+}
+
+// Prefixes implements `Prefixer`.
+func (p *VaultProvider) Prefixes() []string {
+	return []string{VaultPrefix}
+}
+
+// parseKey splits `path#field`, and maps `path` under the mount's
+// `data/` API path.
+func (p *VaultProvider) parseKey(key string) (path, field string, err error) {
+	path = key
+	if idx := strings.LastIndex(key, "#"); idx != -1 {
+		path, field = key[:idx], key[idx+1:]
+	}
+
+	path = strings.Trim(path, "/")
+	dataPrefix := p.Mount + "/data/"
+	if !strings.HasPrefix(path, dataPrefix) {
+		path = dataPrefix + path
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", "", fmt.Errorf("invalid vault path %q", key)
+		}
+	}
+
+	return path, field, nil
+}
+
+// request calls the Vault API, authenticating first if needed. `found`
+// is false when Vault answers 404.
+func (p *VaultProvider) request(method, path string, body interface{}, out interface{}) (found bool, err error) {
+	token, err := p.authToken(false)
+	if err != nil {
+		return false, err
+	}
+
+	status, err := p.do(method, path, token, body, out)
+	if status == http.StatusForbidden && p.RoleID != "" {
+		// The AppRole token probably expired, log in again.
+		if token, err = p.authToken(true); err != nil {
+			return false, err
+		}
+		status, err = p.do(method, path, token, body, out)
+	}
+	if status == http.StatusNotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (p *VaultProvider) authToken(renew bool) (string, error) {
+	if p.RoleID == "" {
+		if p.Token == "" {
+			return "", fmt.Errorf("no vault token nor approle configured")
+		}
+		return p.Token, nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.token != "" && !renew {
+		return p.token, nil
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	login := map[string]string{"role_id": p.RoleID, "secret_id": p.SecretID}
+	if _, err := p.do("POST", "auth/approle/login", "", login, &resp); err != nil {
+		return "", fmt.Errorf("vault approle login: %s", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault approle login: no token returned")
+	}
+
+	p.token = resp.Auth.ClientToken
+	return p.token, nil
+}
+
+func (p *VaultProvider) do(method, path, token string, body interface{}, out interface{}) (status int, err error) {
+	var reqBody io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reqBody = bytes.NewReader(content)
+	}
+
+	u := p.Addr + "/v1/" + escapeVaultPath(path)
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	cnt, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if resp.StatusCode != 200 {
+		return resp.StatusCode, fmt.Errorf("vault %s %s: status %d: %s", method, path, resp.StatusCode, vaultErrors(cnt))
+	}
+
+	if err := json.Unmarshal(cnt, out); err != nil {
+		return resp.StatusCode, fmt.Errorf("vault %s %s: invalid response: %s", method, path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+func escapeVaultPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// vaultErrors extracts the `errors` list of a Vault error response.
+func vaultErrors(body []byte) string {
+	var resp struct {
+		Errors []string `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil || len(resp.Errors) == 0 {
+		return strings.TrimSpace(string(body))
+	}
+	return strings.Join(resp.Errors, ", ")
+}
@@ -0,0 +1,114 @@
+package secrets
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeVault stands in for the Vault HTTP API, with a KV v2 engine
+// mounted at `secret`.
+func fakeVault(t *testing.T, validToken *string) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/auth/approle/login", func(w http.ResponseWriter, r *http.Request) {
+		var login map[string]string
+		json.NewDecoder(r.Body).Decode(&login)
+		if login["role_id"] != "role" || login["secret_id"] != "s3cret" {
+			w.WriteHeader(400)
+			w.Write([]byte(`{"errors":["invalid role or secret ID"]}`))
+			return
+		}
+		*validToken = "approle-token"
+		w.Write([]byte(`{"auth":{"client_token":"approle-token"}}`))
+	})
+	mux.HandleFunc("/v1/secret/data/ci", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != *validToken {
+			w.WriteHeader(403)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+		w.Write([]byte(`{"data":{"data":{"npm_token":"hello","port":5432},"metadata":{"version":3}}}`))
+	})
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(404)
+		w.Write([]byte(`{"errors":[]}`))
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestVaultProviderToken(t *testing.T) {
+	validToken := "root"
+	srv := fakeVault(t, &validToken)
+	defer srv.Close()
+
+	p := NewVaultProvider(srv.URL+"/", "secret")
+	p.Token = "root"
+
+	val, err := p.Get("vault:secret/data/ci#npm_token")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	val, err = p.Get("vault:ci#npm_token")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	val, err = p.Get("vault:ci#port")
+	assert.NoError(t, err)
+	assert.Equal(t, b("5432"), val)
+
+	val, err = p.Get("vault:ci")
+	assert.NoError(t, err)
+	assert.Equal(t, b(`{"npm_token":"hello","port":5432}`), val)
+
+	val, err = p.Get("vault:ci#missing")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	val, err = p.Get("vault:unknown#field")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	val, err = p.Get("npm_token")
+	assert.NoError(t, err)
+	assert.Nil(t, val)
+
+	_, err = p.Get("vault:../../sys/seal#x")
+	assert.Error(t, err)
+
+	p.Token = "wrong"
+	_, err = p.Get("vault:ci#npm_token")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "permission denied")
+	}
+}
+
+func TestVaultProviderAppRole(t *testing.T) {
+	var validToken string
+	srv := fakeVault(t, &validToken)
+	defer srv.Close()
+
+	p := NewVaultProvider(srv.URL, "secret")
+	p.RoleID = "role"
+	p.SecretID = "s3cret"
+
+	val, err := p.Get("vault:ci#npm_token")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	// Token expired on the Vault side: logs in again.
+	validToken = "rotated"
+	val, err = p.Get("vault:ci#npm_token")
+	assert.NoError(t, err)
+	assert.Equal(t, b("hello"), val)
+
+	p = NewVaultProvider(srv.URL, "secret")
+	p.RoleID = "role"
+	p.SecretID = "wrong"
+	_, err = p.Get("vault:ci#npm_token")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid role or secret ID")
+	}
+}
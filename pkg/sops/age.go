@@ -0,0 +1,52 @@
+package sops
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// Identity is an age identity, like `AGE-SECRET-KEY-1...`.
+type Identity = age.Identity
+
+// ParseIdentities reads age identities, one per line, skipping blank
+// lines and `#` comments, as written by `age-keygen`.
+func ParseIdentities(content []byte) ([]Identity, error) {
+	identities, err := age.ParseIdentities(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid age identities: %s", err)
+	}
+	return identities, nil
+}
+
+// ReadIdentitiesFile reads an age identities file, like `keys.txt`.
+func ReadIdentitiesFile(filename string) ([]Identity, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := ParseIdentities(content)
+	if err != nil {
+		return nil, fmt.Errorf("%q: %s", filename, err)
+	}
+	return identities, nil
+}
+
+// ageDecrypt decrypts an age file, armored like sops writes them, or
+// not, with the first identity matching one of its recipients.
+func ageDecrypt(content []byte, identities []Identity) ([]byte, error) {
+	var src io.Reader = bytes.NewReader(content)
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(content)))
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(r)
+}
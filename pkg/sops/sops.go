@@ -0,0 +1,364 @@
+// Package sops decrypts files encrypted by SOPS
+// (https://github.com/getsops/sops) for age recipients, without the
+// `sops` binary. YAML and JSON files are supported.
+package sops
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// metadata is the `sops` entry of an encrypted file.
+type metadata struct {
+	Age []struct {
+		Recipient string `yaml:"recipient"`
+		Enc       string `yaml:"enc"`
+	} `yaml:"age"`
+	LastModified     string `yaml:"lastmodified"`
+	MAC              string `yaml:"mac"`
+	MACOnlyEncrypted bool   `yaml:"mac_only_encrypted"`
+}
+
+var encryptedValueRE = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.*),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// FormatFromFilename returns the format of a file, `json` for `.json`
+// files and `yaml` otherwise, like `sops` guesses it.
+func FormatFromFilename(filename string) string {
+	if strings.ToLower(filepath.Ext(filename)) == ".json" {
+		return "json"
+	}
+	return "yaml"
+}
+
+// Decrypt decrypts a SOPS file, `format` being `yaml` or `json`, and
+// verifies its MAC. It returns the leaves keyed by their path, joined
+// with `/`, like `db/password` or `hosts/0`.
+func Decrypt(content []byte, format string, identities []Identity) (map[string][]byte, error) {
+	var tree yaml.MapSlice
+	var err error
+	switch format {
+	case "yaml":
+		err = yaml.Unmarshal(content, &tree)
+	case "json":
+		tree, err = parseOrderedJSON(content)
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %s", format, err)
+	}
+
+	var data yaml.MapSlice
+	var md *metadata
+	for _, item := range tree {
+		if item.Key == "sops" {
+			if md, err = parseMetadata(item.Value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		data = append(data, item)
+	}
+	if md == nil {
+		return nil, fmt.Errorf("no sops metadata, is the file encrypted with sops?")
+	}
+
+	dataKey, err := md.dataKey(identities)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(dataKey)
+
+	d := &decrypter{
+		key:              dataKey,
+		macOnlyEncrypted: md.MACOnlyEncrypted,
+		hash:             sha512.New(),
+		out:              make(map[string][]byte),
+	}
+	if err := d.walk(data, nil, nil); err != nil {
+		d.wipe()
+		return nil, err
+	}
+
+	if err := d.verifyMAC(md); err != nil {
+		d.wipe()
+		return nil, err
+	}
+
+	return d.out, nil
+}
+
+func parseMetadata(value interface{}) (*metadata, error) {
+	// Round-trip through YAML, to read it from either format.
+	content, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	md := &metadata{}
+	if err := yaml.Unmarshal(content, md); err != nil {
+		return nil, fmt.Errorf("invalid sops metadata: %s", err)
+	}
+	return md, nil
+}
+
+func (md *metadata) dataKey(identities []Identity) ([]byte, error) {
+	if len(md.Age) == 0 {
+		return nil, fmt.Errorf("no age recipients in sops metadata, only age is supported")
+	}
+
+	var lastErr error
+	for _, recipient := range md.Age {
+		key, err := ageDecrypt([]byte(recipient.Enc), identities)
+		if err == nil {
+			return key, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("decrypting sops data key: %s", lastErr)
+}
+
+type decrypter struct {
+	key              []byte
+	macOnlyEncrypted bool
+	hash             hash.Hash
+	out              map[string][]byte
+}
+
+// walk visits the leaves in document order, as `sops` does to compute
+// the MAC. `aadPath` holds the map keys only, which sops authenticates
+// values with, while `keyPath` also holds list indices.
+func (d *decrypter) walk(node interface{}, aadPath, keyPath []string) error {
+	switch node := node.(type) {
+	case yaml.MapSlice:
+		for _, item := range node {
+			key := fmt.Sprint(item.Key)
+			if err := d.walk(item.Value, append(aadPath, key), append(keyPath, key)); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		i := 0
+		for _, value := range node {
+			// Comments in lists are written as items. Like the other
+			// comments, which the YAML parser drops, they aren't part of
+			// the MAC nor of the values.
+			if isComment(value) {
+				continue
+			}
+			if err := d.walk(value, aadPath, append(keyPath, strconv.Itoa(i))); err != nil {
+				return err
+			}
+			i++
+		}
+	default:
+		return d.leaf(node, aadPath, keyPath)
+	}
+	return nil
+}
+
+// isComment tells whether `value` is a comment encrypted by sops.
+func isComment(value interface{}) bool {
+	s, ok := value.(string)
+	if !ok {
+		return false
+	}
+	matches := encryptedValueRE.FindStringSubmatch(s)
+	return matches != nil && matches[4] == "comment"
+}
+
+func (d *decrypter) leaf(value interface{}, aadPath, keyPath []string) error {
+	key := strings.Join(keyPath, "/")
+
+	if s, ok := value.(string); ok {
+		if matches := encryptedValueRE.FindStringSubmatch(s); matches != nil {
+			plaintext, err := d.decryptValue(matches, strings.Join(aadPath, ":")+":")
+			if err != nil {
+				return fmt.Errorf("decrypting %q: %s", key, err)
+			}
+			d.hash.Write(plaintext)
+
+			if matches[4] == "bool" {
+				lower := []byte(strings.ToLower(string(plaintext)))
+				wipe(plaintext)
+				plaintext = lower
+			}
+			d.out[key] = plaintext
+			return nil
+		}
+	}
+
+	if !d.macOnlyEncrypted {
+		d.hash.Write(macBytes(value))
+	}
+	d.out[key] = []byte(plainString(value))
+	return nil
+}
+
+func (d *decrypter) decryptValue(matches []string, additionalData string) ([]byte, error) {
+	var parts [3][]byte
+	for i, encoded := range matches[1:4] {
+		decoded, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64: %s", err)
+		}
+		parts[i] = decoded
+	}
+	ciphertext, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(d.key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := gcm.Open(nil, iv, append(ciphertext, tag...), []byte(additionalData))
+	if err != nil {
+		return nil, fmt.Errorf("authentication failed")
+	}
+	return plaintext, nil
+}
+
+func (d *decrypter) verifyMAC(md *metadata) error {
+	matches := encryptedValueRE.FindStringSubmatch(md.MAC)
+	if matches == nil {
+		return fmt.Errorf("missing or invalid sops MAC")
+	}
+
+	// The MAC is authenticated with the modification time, formatted
+	// like sops does.
+	lastModified, err := time.Parse(time.RFC3339, md.LastModified)
+	if err != nil {
+		return fmt.Errorf("invalid sops lastmodified: %s", err)
+	}
+
+	expected, err := d.decryptValue(matches, lastModified.Format(time.RFC3339))
+	if err != nil {
+		return fmt.Errorf("decrypting sops MAC: %s", err)
+	}
+
+	computed := fmt.Sprintf("%X", d.hash.Sum(nil))
+	if subtle.ConstantTimeCompare(expected, []byte(computed)) != 1 {
+		return fmt.Errorf("sops MAC mismatch, the file was tampered with")
+	}
+	return nil
+}
+
+func (d *decrypter) wipe() {
+	for _, value := range d.out {
+		wipe(value)
+	}
+}
+
+// macBytes converts unencrypted values like sops does when computing
+// the MAC.
+func macBytes(value interface{}) []byte {
+	switch value := value.(type) {
+	case bool:
+		if value {
+			return []byte("True")
+		}
+		return []byte("False")
+	case float64:
+		return []byte(strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return []byte(plainString(value))
+}
+
+func plainString(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
+// parseOrderedJSON reads a JSON object, keeping the order of the keys,
+// which the MAC depends on.
+func parseOrderedJSON(content []byte) (yaml.MapSlice, error) {
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+
+	value, err := readJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	tree, ok := value.(yaml.MapSlice)
+	if !ok {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+	return tree, nil
+}
+
+func readJSONValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		switch token {
+		case '{':
+			var out yaml.MapSlice
+			for dec.More() {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := readJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, yaml.MapItem{Key: key, Value: value})
+			}
+			_, err := dec.Token()
+			return out, err
+		case '[':
+			out := []interface{}{}
+			for dec.More() {
+				value, err := readJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, value)
+			}
+			_, err := dec.Token()
+			return out, err
+		}
+		return nil, fmt.Errorf("unexpected %s", token)
+	case json.Number:
+		if i, err := token.Int64(); err == nil {
+			return int(i), nil
+		}
+		return token.Float64()
+	}
+	return token, nil
+}
+
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
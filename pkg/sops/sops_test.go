@@ -0,0 +1,132 @@
+package sops
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The fixtures in testdata were encrypted with `sops -e --age` for the
+// throwaway identity in testdata/keys.txt.
+
+func readFixture(t *testing.T, name string) []byte {
+	content, err := ioutil.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func testIdentities(t *testing.T) []Identity {
+	identities, err := ReadIdentitiesFile("testdata/keys.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return identities
+}
+
+func stringValues(values map[string][]byte) map[string]string {
+	out := make(map[string]string)
+	for key, value := range values {
+		out[key] = string(value)
+	}
+	return out
+}
+
+func TestDecryptYAML(t *testing.T) {
+	values, err := Decrypt(readFixture(t, "secrets.enc.yaml"), "yaml", testIdentities(t))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"db/user":             "app",
+		"db/password":         "s3cr3t",
+		"db/port":             "5432",
+		"hosts/0":             "alpha",
+		"hosts/1":             "beta",
+		"enabled":             "true",
+		"ratio":               "0.5",
+		"nested/list/0/name":  "one",
+		"nested/list/0/token": "t1",
+		"public_unencrypted":  "visible",
+	}, stringValues(values))
+}
+
+func TestDecryptComments(t *testing.T) {
+	// sops encrypts comments, and writes those in lists as items.
+	values, err := Decrypt(readFixture(t, "comments.enc.yaml"), "yaml", testIdentities(t))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"db/user":             "app",
+		"db/password":         "s3cr3t",
+		"hosts/0":             "alpha",
+		"hosts/1":             "beta",
+		"nested/list/0/name":  "one",
+		"nested/list/0/token": "t1",
+		"nested/list/1/0":     "x",
+		"nested/list/1/1":     "y",
+	}, stringValues(values))
+}
+
+func TestDecryptJSON(t *testing.T) {
+	values, err := Decrypt(readFixture(t, "secrets.enc.json"), "json", testIdentities(t))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"zeta":        "last-first",
+		"db/password": "js3cr3t",
+		"db/port":     "5432",
+		"flag":        "false",
+		"items/0":     "x",
+		"items/1":     "y",
+	}, stringValues(values))
+}
+
+func TestDecryptTampered(t *testing.T) {
+	content := string(readFixture(t, "secrets.enc.yaml"))
+
+	// Swapping two values keeps them decryptable on their own, but not
+	// under another key.
+	lines := strings.Split(content, "\n")
+	lines[1], lines[2] = strings.Replace(lines[2], "password", "user", 1), strings.Replace(lines[1], "user", "password", 1)
+	_, err := Decrypt([]byte(strings.Join(lines, "\n")), "yaml", testIdentities(t))
+	assert.Error(t, err)
+
+	// Changing an unencrypted value breaks the MAC.
+	_, err = Decrypt([]byte(strings.Replace(content, "public_unencrypted: visible", "public_unencrypted: changed", 1)), "yaml", testIdentities(t))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "MAC mismatch")
+	}
+}
+
+func TestDecryptWrongIdentity(t *testing.T) {
+	other, err := ParseIdentities([]byte("AGE-SECRET-KEY-1CTXLVEGVN89ZAFATSVDNP0206ZJCN7G2NN3W6FGE7T2R0TEEACXSARKSYZ\n"))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	_, err = Decrypt(readFixture(t, "secrets.enc.yaml"), "yaml", other)
+	assert.Error(t, err)
+}
+
+func TestDecryptNotEncrypted(t *testing.T) {
+	_, err := Decrypt([]byte("key: value\n"), "yaml", testIdentities(t))
+	assert.Error(t, err)
+}
+
+func TestParseIdentities(t *testing.T) {
+	_, err := ParseIdentities([]byte("# nothing here\n\n"))
+	assert.Error(t, err)
+
+	_, err = ParseIdentities([]byte("AGE-SECRET-KEY-15RTU7MX0PMW7V2XJ2S80SHY9DJW0RKC0GWYVAND5J8F4GGCY7CMQMP3KYQ\n"))
+	assert.Error(t, err, "bad checksum")
+
+	identities, err := ParseIdentities(readFixture(t, "keys.txt"))
+	assert.NoError(t, err)
+	assert.Len(t, identities, 1)
+}
+
+func TestFormatFromFilename(t *testing.T) {
+	assert.Equal(t, "json", FormatFromFilename("secrets.enc.JSON"))
+	assert.Equal(t, "yaml", FormatFromFilename("secrets.enc.yaml"))
+	assert.Equal(t, "yaml", FormatFromFilename("secrets"))
+}